@@ -1,13 +1,44 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ubports/nuntium/mms"
+)
+
 const (
 	ErrorActivateContext = "x-ubports-nuntium-mms-error-activate-context"
 	ErrorGetProxy        = "x-ubports-nuntium-mms-error-get-proxy"
 	ErrorDownloadContent = "x-ubports-nuntium-mms-error-download-content"
 	ErrorStorage         = "x-ubports-nuntium-mms-error-storage"
 	ErrorForward         = "x-ubports-nuntium-mms-error-forward"
+	ErrorMessageTooLarge = "x-ubports-nuntium-mms-error-message-too-large"
+	ErrorCancelled       = "x-ubports-nuntium-mms-error-cancelled"
+)
+
+// Errors of outgoing messages.
+const (
+	ErrorAttachment        = "x-ubports-nuntium-mms-error-attachment"
+	ErrorEncode            = "x-ubports-nuntium-mms-error-encode"
+	ErrorGetMessageCenter  = "x-ubports-nuntium-mms-error-get-message-center"
+	ErrorUploadContent     = "x-ubports-nuntium-mms-error-upload-content"
+	ErrorUploadTimeout     = "x-ubports-nuntium-mms-error-upload-timeout"
+	ErrorDecodeSendConf    = "x-ubports-nuntium-mms-error-decode-send-conf"
+	ErrorSendRejected      = "x-ubports-nuntium-mms-error-send-rejected"
+	ErrorServiceDenied     = "x-ubports-nuntium-mms-error-service-denied"
+	ErrorFormatCorrupt     = "x-ubports-nuntium-mms-error-message-format-corrupt"
+	ErrorAddressUnresolved = "x-ubports-nuntium-mms-error-address-unresolved"
+	ErrorMessageNotFound   = "x-ubports-nuntium-mms-error-message-not-found"
+	ErrorNetworkProblem    = "x-ubports-nuntium-mms-error-network-problem"
+	ErrorContentRejected   = "x-ubports-nuntium-mms-error-content-not-accepted"
+	ErrorUnsupported       = "x-ubports-nuntium-mms-error-unsupported-message"
+	ErrorReplyCharging     = "x-ubports-nuntium-mms-error-reply-charging"
 )
 
+// errNoTelepathyService is returned for transfers attempted while the modem has no telepathy service.
+var errNoTelepathyService = errors.New("no telepathy service")
+
 type standartizedError struct {
 	error
 	code string
@@ -20,3 +51,51 @@ type downloadError struct {
 }
 
 func (e downloadError) AllowRedownload() bool { return true }
+
+// uploadError returns the standardized error of a failed upload.
+func uploadError(err error) error {
+	if err == mms.ErrUploadTimeout {
+		return standartizedError{err, ErrorUploadTimeout}
+	}
+	return standartizedError{err, ErrorUploadContent}
+}
+
+// sendConfError returns the standardized error for the response status of a m-send.conf
+// rejecting the message. Transient and permanent failures of a kind share the code.
+func sendConfError(mSendConf *mms.MSendConf) error {
+	err := fmt.Errorf("message center rejected the message with response status %d: %s", mSendConf.ResponseStatus, mSendConf.ResponseText)
+	var code string
+	switch mSendConf.ResponseStatus {
+	case mms.ResponseStatusErrorServiceDenied,
+		mms.ResponseStatusErrorPermanentServiceDenied:
+		code = ErrorServiceDenied
+	case mms.ResponseStatusErrorMessageFormatCorrupt,
+		mms.ResponseStatusErrorPermanentMessageFormatCorrupt:
+		code = ErrorFormatCorrupt
+	case mms.ResponseStatusErrorSendingAddressUnresolved,
+		mms.ResponseStatusErrorTransientAddressUnresolved,
+		mms.ResponseStatusErrorPermanentAddressUnresolved:
+		code = ErrorAddressUnresolved
+	case mms.ResponseStatusErrorMessageNotFound,
+		mms.ResponseStatusErrorTransientMessageNotFound,
+		mms.ResponseStatusErrorPermanentMessageNotFound:
+		code = ErrorMessageNotFound
+	case mms.ResponseStatusErrorNetworkProblem,
+		mms.ResponseStatusErrorTransientNetworkProblem:
+		code = ErrorNetworkProblem
+	case mms.ResponseStatusErrorContentNotAccepted,
+		mms.ResponseStatusErrorPermanentContentNotAccepted:
+		code = ErrorContentRejected
+	case mms.ResponseStatusErrorUnsupportedMessage:
+		code = ErrorUnsupported
+	case mms.ResponseStatusErrorPermanentReplyChargingLimitationsNotMet,
+		mms.ResponseStatusErrorPermanentReplyChargingRequestNotAccepted,
+		mms.ResponseStatusErrorPermanentReplyChargingForwardingDenied,
+		mms.ResponseStatusErrorPermanentReplyChargingNotSupported:
+		code = ErrorReplyCharging
+	default:
+		// Unspecified, generic and reserved failures.
+		code = ErrorSendRejected
+	}
+	return standartizedError{err, code}
+}
@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
 	"os/user"
 	"sync"
@@ -43,28 +44,89 @@ type Mediator struct {
 	NewMNotificationInd     chan *mms.MNotificationInd
 	NewMSendReq             chan *mms.MSendReq
 	NewMSendReqFile         chan struct{ filePath, uuid string }
+	NewMReadRecInd          chan *mms.MReadRecInd
 	outMessage              chan *telepathy.OutgoingMessage
+	sendCancel              chan string
+	downloadCancel          chan string
 	terminate               chan bool
 	contextLock             sync.Mutex
 	unrespondedTransactions map[string]string // transactionId: UUID
+	outgoingLock            sync.Mutex
+	outgoing                map[string]*outgoingSend // UUID: send in progress
+	downloadsLock           sync.Mutex
+	downloads               map[string]chan struct{} // UUID: cancel of download in progress
+	mobileDataWatch         *dbus.SignalWatch
+}
+
+// outgoingSend tracks an outgoing message until it is sent, fails or is cancelled.
+type outgoingSend struct {
+	// cancel is closed when the message is cancelled.
+	cancel chan struct{}
+	// retry is the timer of the next scheduled attempt to send.
+	retry *time.Timer
+}
+
+func (send *outgoingSend) cancelled() bool {
+	select {
+	case <-send.cancel:
+		return true
+	default:
+		return false
+	}
 }
 
 //TODO these vars need a configuration location managed by system settings or
 //some UI accessible location.
 //useDeliveryReports is set in ofono
 var (
-	deferredDownload   bool
 	useDeliveryReports bool
 )
 
+// transportEnv names the environment variable selecting the transport to the MMS center. By default
+// messages are downloaded with net/http, which resumes interrupted downloads, and uploaded with udm.
+// "http" selects net/http and "udm" selects udm for both.
+const transportEnv = "NUNTIUM_TRANSPORT"
+
+// Outgoing messages failing transiently are retried after sendRetryInitialDelay,
+// doubling the delay on each attempt up to sendRetryMaxDelay.
+const (
+	maxSendAttempts       = 10
+	sendRetryInitialDelay = 30 * time.Second
+	sendRetryMaxDelay     = 30 * time.Minute
+)
+
+// Sent messages are kept in storage for sentRetention to match the delivery and read reports against,
+// which arrive at the latest when the message expires at the MMS center.
+const sentRetention = 14 * 24 * time.Hour
+
+// Incoming messages failing to download are retried automatically after downloadRetryInitialDelay,
+// doubling the delay on each attempt up to downloadRetryMaxDelay, until the message expires.
+const (
+	maxDownloadAttempts       = 10
+	downloadRetryInitialDelay = time.Minute
+	downloadRetryMaxDelay     = time.Hour
+	// retryJitter is the maximal fraction of a retry delay, the delay is randomly shortened or prolonged by.
+	retryJitter = 0.2
+)
+
+var (
+	jitterLock sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
 func NewMediator(modem *ofono.Modem) *Mediator {
 	mediator := &Mediator{modem: modem}
 	mediator.NewMNotificationInd = make(chan *mms.MNotificationInd)
 	mediator.NewMSendReq = make(chan *mms.MSendReq)
 	mediator.NewMSendReqFile = make(chan struct{ filePath, uuid string })
+	mediator.NewMReadRecInd = make(chan *mms.MReadRecInd)
 	mediator.outMessage = make(chan *telepathy.OutgoingMessage)
+	mediator.sendCancel = make(chan string)
+	mediator.downloadCancel = make(chan string)
 	mediator.terminate = make(chan bool)
 	mediator.unrespondedTransactions = make(map[string]string)
+	mediator.outgoing = make(map[string]*outgoingSend)
+	mediator.downloads = make(map[string]chan struct{})
 	return mediator
 }
 
@@ -87,31 +149,52 @@ mediatorLoop:
 			}
 			go mediator.handlePushAgentNotification(push, mediator.modem.Identity())
 		case mNotificationInd := <-mediator.NewMNotificationInd:
-			if deferredDownload {
+			// Messages already deferred or redownloaded were requested to download by user.
+			if mediator.telepathyService.DeferredDownload() && !mNotificationInd.Deferred && mNotificationInd.RedownloadOfUUID == "" {
 				go mediator.handleDeferredDownload(mNotificationInd)
 			} else {
-				go mediator.handleMNotificationInd(mNotificationInd)
+				// Registered before handling, as the redownload can be cancelled right after it was requested.
+				cancel := mediator.addDownload(mNotificationInd)
+				go mediator.handleMNotificationInd(mNotificationInd, cancel)
 			}
 		case msg := <-mediator.outMessage:
 			go mediator.handleOutgoingMessage(msg)
+		case uuid := <-mediator.sendCancel:
+			go mediator.handleSendCancel(uuid)
+		case uuid := <-mediator.downloadCancel:
+			go mediator.handleDownloadCancel(uuid)
 		case mSendReq := <-mediator.NewMSendReq:
 			go mediator.handleMSendReq(mSendReq)
 		case mSendReqFile := <-mediator.NewMSendReqFile:
 			go mediator.sendMSendReq(mSendReqFile.filePath, mSendReqFile.uuid)
+		case mReadRecInd := <-mediator.NewMReadRecInd:
+			go mediator.handleMReadRecInd(mReadRecInd)
 		case id := <-mediator.modem.IdentityAdded:
 			var err error
-			mediator.telepathyService, err = mmsManager.AddService(id, mediator.modem.Modem, mediator.outMessage, useDeliveryReports, mediator.NewMNotificationInd)
+			mediator.telepathyService, err = mmsManager.AddService(id, mediator.modem.Modem, mediator.outMessage, useDeliveryReports, mediator.NewMNotificationInd, mediator.NewMReadRecInd, mediator.sendCancel, mediator.downloadCancel)
 			if err != nil {
 				log.Fatal(err)
 			}
 
 			mediator.initializeMessages(id)
+			mediator.watchMobileDataEnabled()
 		case id := <-mediator.modem.IdentityRemoved:
 			err := mmsManager.RemoveService(id)
 			if err != nil {
 				log.Fatal(err)
 			}
+			if mediator.mobileDataWatch != nil {
+				if err := mediator.mobileDataWatch.Cancel(); err != nil {
+					log.Printf("Error cancelling mobile data watch: %v", err)
+				}
+				mediator.mobileDataWatch = nil
+			}
+			mediator.stopSendRetries()
 			mediator.telepathyService = nil
+		case online := <-mediator.modem.OnlineChanged:
+			if online {
+				go mediator.retryDownloadsNow()
+			}
 		case ok := <-mediator.modem.PushInterfaceAvailable:
 			if ok {
 				if err := mediator.modem.PushAgent.Register(); err != nil {
@@ -146,6 +229,20 @@ func (mediator *Mediator) handlePushAgentNotification(pushMsg *ofono.PushPDU, mo
 		return
 	}
 
+	messageType, err := mms.GetMessageType(pushMsg.Data)
+	if err != nil {
+		log.Println("Unable to determine pushed message type:", err)
+		return
+	}
+	switch messageType {
+	case mms.TYPE_DELIVERY_IND:
+		mediator.handleMDeliveryInd(pushMsg.Data)
+		return
+	case mms.TYPE_READ_ORIG_IND:
+		mediator.handleMReadOrigInd(pushMsg.Data)
+		return
+	}
+
 	dec := mms.NewDecoder(pushMsg.Data)
 	mNotificationInd := mms.NewMNotificationInd(time.Now())
 	if err := dec.Decode(mNotificationInd); err != nil {
@@ -174,18 +271,135 @@ func (mediator *Mediator) handlePushAgentNotification(pushMsg *ofono.PushPDU, mo
 	mediator.NewMNotificationInd <- mNotificationInd
 }
 
+// handleMDeliveryInd decodes the pushed m-delivery.ind, updates the delivery status
+// of the reported recipient in the sent message storage and signals it to telepathy.
+func (mediator *Mediator) handleMDeliveryInd(data []byte) {
+	dec := mms.NewDecoder(data)
+	mDeliveryInd := mms.NewMDeliveryInd()
+	if err := dec.Decode(mDeliveryInd); err != nil {
+		log.Println("Unable to decode m-delivery.ind: ", err, "with log", dec.GetLog())
+		return
+	}
+
+	uuid, err := storage.GetSentUUID(mDeliveryInd.MessageId)
+	if err != nil {
+		log.Printf("Ignoring m-delivery.ind for message id %s: %v", mDeliveryInd.MessageId, err)
+		return
+	}
+
+	status := storage.DeliveryStatus(mDeliveryInd.Status)
+	for _, recipient := range mms.AddressValues(mDeliveryInd.To) {
+		mmsState, err := storage.UpdateSendState(uuid, recipient, status)
+		if err != nil {
+			log.Printf("Error updating storage (UpdateSendState) for %s: %v", uuid, err)
+			continue
+		}
+		if mediator.telepathyService == nil {
+			log.Printf("No telepathy service to report delivery of %s to %s", uuid, recipient)
+			continue
+		}
+		if err := mediator.telepathyService.MessageDeliveryReported(uuid, recipient, status); err != nil {
+			log.Println(err)
+		}
+		if err := mediator.telepathyService.MessageRecipientStatusChanged(uuid, mmsState.SendState); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// handleMReadOrigInd decodes the pushed m-read-orig.ind and signals to telepathy,
+// that the sent message was read by the recipient.
+func (mediator *Mediator) handleMReadOrigInd(data []byte) {
+	dec := mms.NewDecoder(data)
+	mReadOrigInd := mms.NewMReadOrigInd()
+	if err := dec.Decode(mReadOrigInd); err != nil {
+		log.Println("Unable to decode m-read-orig.ind: ", err, "with log", dec.GetLog())
+		return
+	}
+
+	uuid, err := storage.GetSentUUID(mReadOrigInd.MessageId)
+	if err != nil {
+		log.Printf("Ignoring m-read-orig.ind for message id %s: %v", mReadOrigInd.MessageId, err)
+		return
+	}
+
+	if mReadOrigInd.ReadStatus != mms.ReadStatusRead {
+		log.Printf("Message %s was deleted by %s without being read", uuid, mReadOrigInd.From)
+		return
+	}
+	if mediator.telepathyService == nil {
+		log.Printf("No telepathy service to report message %s was read", uuid)
+		return
+	}
+	if err := mediator.telepathyService.MessageRead(uuid); err != nil {
+		log.Println(err)
+	}
+}
+
+// Defers the download of message notified by mNotificationInd.
+// The MMS center is notified with m-notifyresp.ind with deferred status and telepathy is notified with a "deferred" message,
+// which download can be started by the user later (see MMSService.IncomingMessageDeferredAdded).
+//
+// Reading:
+//	https://developer.brewmp.com/resources/tech-guides/multimedia-messaging-service-mms-technology-guide/mms-protocol-overview/mms-fe/receiving-mms-message - instructions on how to deffer.
+//	https://www.slideshare.net/glebodic/mobile-messaging-part-5-76-mms-arch-and-transactions-reduced - has deferred instructions
 func (mediator *Mediator) handleDeferredDownload(mNotificationInd *mms.MNotificationInd) {
-	//TODO send MessageAdded with status="deferred" and mNotificationInd relevant headers
-	//
-	//Reading:
-	//	http://www.openmobilealliance.org/release/MMS/V1_1-20021104-C/OMA-WAP-MMS-ENC-V1_1-20021030-C.pdf - no deferred instructions, just mentions.
-	//	https://dl.cdn-anritsu.com/en-gb/test-measurement/files/Technical-Notes/White-Paper/MC-MMS_Signaling_Examples_and_KPI_Calculations-WP-1_0.pdf - no defered instructions, just mentions.
-	//	https://developer.brewmp.com/resources/tech-guides/multimedia-messaging-service-mms-technology-guide/mms-protocol-overview/mms-fe/receiving-mms-message - instructions on how to deffer.
-	//	https://www.slideshare.net/glebodic/mobile-messaging-part-5-76-mms-arch-and-transactions-reduced - has deferred instructions
-	//
-	//Notes:
-	//	If the application chooses to download the message at a later point in time, then an M-NotifyResp.ind is sent with the deferred flag set to acknowledge the receipt notification and notify that message download is deferred.
+	mediator.contextLock.Lock()
+	defer mediator.contextLock.Unlock()
+
+	if mNotificationInd.TransactionId != "" {
+		// Some operators repeatedly push mNotificationInd with the same transaction id, don't defer the same message twice.
+		if uuid, ok := mediator.unrespondedTransactions[mNotificationInd.TransactionId]; ok && uuid != mNotificationInd.UUID {
+			if st, err := storage.GetMMSState(uuid); err == nil && st.MNotificationInd != nil && st.MNotificationInd.Deferred {
+				log.Printf("MNotificationInd with TransactionId: \"%s\" was already deferred by UUID: \"%s\"", mNotificationInd.TransactionId, uuid)
+				if err := storage.Destroy(mNotificationInd.UUID); err != nil {
+					log.Printf("Error removing message %s from storage: %v", mNotificationInd.UUID, err)
+				}
+				return
+			}
+		}
+		mediator.unrespondedTransactions[mNotificationInd.TransactionId] = mNotificationInd.UUID
+	}
+
+	// Notify MMS center about deferred download.
+	if !mNotificationInd.IsDebug() {
+		if err := mediator.sendDeferredMNotifyRespInd(mNotificationInd); err != nil {
+			// The message is deferred anyway, the retrieval will be acknowledged by m-acknowledge.ind, which MMS centers accept.
+			log.Println("Error notifying MMS center about deferred download: ", err)
+		}
+	} else {
+		log.Print("This is a local test, skipping m-notifyresp.ind")
+	}
+
+	// Store the deferred state, to survive restarts.
+	mNotificationInd.Deferred = true
+	if _, err := storage.UpdateMNotificationInd(mNotificationInd); err != nil {
+		log.Println("Error updating storage (UpdateMNotificationInd): ", err)
+		return
+	}
 
+	if err := mediator.telepathyService.IncomingMessageDeferredAdded(mNotificationInd); err != nil {
+		log.Printf("Error adding deferred message %s to telepathy: %v", mNotificationInd.UUID, err)
+	}
+}
+
+func (mediator *Mediator) sendDeferredMNotifyRespInd(mNotificationInd *mms.MNotificationInd) error {
+	mmsContext, deactivateMMSContext, err := mediator.activateMMSContext()
+	if err != nil {
+		return fmt.Errorf("error activating ofono context: %w", err)
+	}
+	if deactivateMMSContext != nil {
+		defer deactivateMMSContext()
+	}
+
+	filePath := mediator.handleMNotifyRespInd(mNotificationInd.NewMNotifyRespInd(mms.STATUS_DEFERRED, useDeliveryReports))
+	if filePath == "" {
+		return fmt.Errorf("Getting file for m-notifyresp.ind failed")
+	}
+	if err := mediator.sendMNotifyRespInd(filePath, &mmsContext); err != nil {
+		return fmt.Errorf("error sending m-notifyresp.ind: %w", err)
+	}
+	return nil
 }
 
 func (mediator *Mediator) activateMMSContext() (mmsContext ofono.OfonoContext, deactivationFunc func(), err error) {
@@ -212,7 +426,14 @@ func (mediator *Mediator) debugMMSContextError(mNotificationInd *mms.MNotificati
 	return nil
 }
 
-func (mediator *Mediator) handleMNotificationInd(mNotificationInd *mms.MNotificationInd) {
+// handleMNotificationInd downloads the message mNotificationInd refers to, unless cancel is closed.
+// The download can be cancelled while waiting for other transfers to end, too.
+func (mediator *Mediator) handleMNotificationInd(mNotificationInd *mms.MNotificationInd, cancel <-chan struct{}) {
+	if mNotificationInd.RedownloadOfUUID != "" {
+		defer mediator.removeDownload(mNotificationInd.RedownloadOfUUID)
+		defer mediator.telepathyService.RedownloadEnded(mNotificationInd.RedownloadOfUUID)
+	}
+
 	mediator.contextLock.Lock()
 	defer mediator.contextLock.Unlock()
 
@@ -230,6 +451,14 @@ func (mediator *Mediator) handleMNotificationInd(mNotificationInd *mms.MNotifica
 		}
 	}
 
+	select {
+	case <-cancel:
+		log.Printf("Download of %s was cancelled", mNotificationInd.UUID)
+		mediator.handleMessageDownloadError(mNotificationInd, downloadError{standartizedError{mms.ErrCancelled, ErrorCancelled}})
+		return
+	default:
+	}
+
 	var proxy ofono.ProxyInfo
 	var mmsContext ofono.OfonoContext
 	if mNotificationInd.IsDebug() {
@@ -264,18 +493,32 @@ func (mediator *Mediator) handleMNotificationInd(mNotificationInd *mms.MNotifica
 		}
 	}
 
-	// Download message content.
-	if filePath, err := mNotificationInd.DownloadContent(proxy.Host, int32(proxy.Port)); err != nil {
+	// Download message content, resuming the content downloaded by previous attempts.
+	partialFile, err := storage.GetPartialDownload(mNotificationInd.UUID)
+	if err != nil {
+		log.Printf("Error getting partial download file of %s, downloading whole: %v", mNotificationInd.UUID, err)
+		partialFile = ""
+	}
+	// The progress is signalled on the redownloaded message, the client doesn't know this one yet.
+	progress := mediator.telepathyService.TransferProgress(mNotificationInd.RedownloadOfUUID)
+	filePath, err := mNotificationInd.DownloadContent(newDownloadTransport(proxy, &mmsContext), partialFile, cancel, progress)
+	// The redownloaded message is removed before this one is added.
+	mediator.telepathyService.RedownloadEnded(mNotificationInd.RedownloadOfUUID)
+	if err == mms.ErrCancelled {
+		// The content downloaded so far is kept, to resume on redownload.
+		log.Printf("Download of %s was cancelled", mNotificationInd.UUID)
+		mediator.handleMessageDownloadError(mNotificationInd, downloadError{standartizedError{err, ErrorCancelled}})
+		return
+	} else if err != nil {
 		log.Print("Download issues: ", err)
 		mediator.handleMessageDownloadError(mNotificationInd, downloadError{standartizedError{err, ErrorDownloadContent}})
 		return
-	} else {
-		// Save message to storage and update state to DOWNLOADED.
-		if _, err := storage.UpdateDownloaded(mNotificationInd.UUID, filePath); err != nil {
-			log.Println("Error updating storage (UpdateDownloaded): ", err)
-			mediator.handleMessageDownloadError(mNotificationInd, downloadError{standartizedError{err, ErrorStorage}})
-			return
-		}
+	}
+	// Save message to storage and update state to DOWNLOADED.
+	if _, err := storage.UpdateDownloaded(mNotificationInd.UUID, filePath); err != nil {
+		log.Println("Error updating storage (UpdateDownloaded): ", err)
+		mediator.handleMessageDownloadError(mNotificationInd, downloadError{standartizedError{err, ErrorStorage}})
+		return
 	}
 
 	// Forward message to telepathy service.
@@ -290,17 +533,14 @@ func (mediator *Mediator) handleMNotificationInd(mNotificationInd *mms.MNotifica
 		log.Println("Error updating storage (UpdateRetrieved): ", err)
 		return
 	}
+	if _, err := mediator.storeMReadRecInd(mNotificationInd, mRetrieveConf); err != nil {
+		log.Println("Error updating storage (UpdateMReadRecInd): ", err)
+	}
 
 	// Notify MMS center about successful download.
-	mNotifyRespInd := mRetrieveConf.NewMNotifyRespInd(useDeliveryReports)
 	if !mNotificationInd.IsDebug() {
-		// TODO deferred case
-		filePath := mediator.handleMNotifyRespInd(mNotifyRespInd)
-		if filePath == "" {
-			return
-		}
-		if err := mediator.sendMNotifyRespInd(filePath, &mmsContext); err != nil {
-			log.Println("Error sending m-notifyresp.ind: ", err)
+		if err := mediator.sendRetrievalResponse(mNotificationInd, mRetrieveConf, &mmsContext); err != nil {
+			log.Println("Error responding to MMS center: ", err)
 			return
 		}
 	} else {
@@ -314,7 +554,7 @@ func (mediator *Mediator) handleMNotificationInd(mNotificationInd *mms.MNotifica
 	// MMS center is notified, that the message was downloaded, we can remove the TransactionId from unrespondedTransactions.
 	delete(mediator.unrespondedTransactions, mNotificationInd.TransactionId)
 	// Update message state in storage to RESPONDED.
-	if _, err := storage.UpdateResponded(mNotifyRespInd.UUID); err != nil {
+	if _, err := storage.UpdateResponded(mRetrieveConf.UUID); err != nil {
 		log.Println("Error updating storage (UpdateResponded): ", err)
 		return
 	}
@@ -323,6 +563,10 @@ func (mediator *Mediator) handleMNotificationInd(mNotificationInd *mms.MNotifica
 // Communicates the download error "err" of mNotificationInd to telepathy service.
 // Some operators repeatedly push mNotificationInd with the same transaction id, if download not acknowledged by mNotifyRespInd. So we have to make sure, to communicate the download error just once.
 func (mediator *Mediator) handleMessageDownloadError(mNotificationInd *mms.MNotificationInd, err error) {
+	if mNotificationInd.RedownloadOfUUID != "" {
+		// The redownloaded message is removed before this one is added.
+		mediator.telepathyService.RedownloadEnded(mNotificationInd.RedownloadOfUUID)
+	}
 	unrespondedUUID, inUnresponded := mediator.unrespondedTransactions[mNotificationInd.TransactionId]
 
 	if mNotificationInd.TransactionId != "" && mNotificationInd.RedownloadOfUUID == "" && inUnresponded && unrespondedUUID != mNotificationInd.UUID {
@@ -391,6 +635,110 @@ func (mediator *Mediator) handleMessageDownloadError(mNotificationInd *mms.MNoti
 		// Force this message to be unhandled.
 		mediator.unrespondedTransactions[mNotificationInd.TransactionId] = mNotificationInd.UUID
 	}
+
+	// Downloads cancelled by user are left for the user to redownload.
+	if se, ok := err.(interface{ Code() string }); ok && se.Code() == ErrorCancelled {
+		return
+	}
+	if ari, ok := err.(interface{ AllowRedownload() bool }); ok && ari.AllowRedownload() {
+		mediator.scheduleDownloadRetry(mNotificationInd)
+	}
+}
+
+// scheduleDownloadRetry schedules an automatic redownload of the stored mNotificationInd, which failed to
+// download, with an exponential backoff. Gives up after maxDownloadAttempts or if the message would expire
+// before the next attempt.
+func (mediator *Mediator) scheduleDownloadRetry(mNotificationInd *mms.MNotificationInd) {
+	uuid := mNotificationInd.UUID
+	mmsState, err := storage.GetMMSState(uuid)
+	if err != nil {
+		log.Printf("Error retrieving state of %s to retry downloading: %v", uuid, err)
+		return
+	}
+	if mmsState.Attempts+1 >= maxDownloadAttempts {
+		log.Printf("Giving up downloading %s automatically after %d attempts", uuid, mmsState.Attempts+1)
+		return
+	}
+
+	nextAttempt := time.Now().Add(withJitter(retryDelay(mmsState.Attempts, downloadRetryInitialDelay, downloadRetryMaxDelay)))
+	if !nextAttempt.Before(mNotificationInd.Expire()) {
+		log.Printf("Giving up downloading %s automatically, it expires at %s", uuid, mNotificationInd.Expire())
+		return
+	}
+	if _, err := storage.UpdateAttempt(uuid, nextAttempt); err != nil {
+		log.Printf("Error updating storage (UpdateAttempt) for %s: %v", uuid, err)
+		return
+	}
+	log.Printf("Retrying to download %s at %s", uuid, nextAttempt)
+	mediator.retryDownloadAt(uuid, nextAttempt)
+}
+
+func (mediator *Mediator) retryDownloadAt(uuid string, nextAttempt time.Time) {
+	time.AfterFunc(time.Until(nextAttempt), func() {
+		mediator.retryDownload(uuid)
+	})
+}
+
+// retryDownload redownloads the stored message identified by uuid, if it still waits for an automatic retry.
+// A message, which was meanwhile redownloaded, downloaded, deleted or expired, is left alone.
+func (mediator *Mediator) retryDownload(uuid string) {
+	mmsState, err := storage.GetMMSState(uuid)
+	if err != nil {
+		// Message was redownloaded or deleted meanwhile.
+		return
+	}
+	if mmsState.State != storage.NOTIFICATION || mmsState.NextAttempt.IsZero() || mmsState.MNotificationInd == nil {
+		return
+	}
+	if mmsState.MNotificationInd.Expired() {
+		log.Printf("Not retrying to download %s, it is expired", uuid)
+		return
+	}
+	telepathyService := mediator.telepathyService
+	if telepathyService == nil {
+		log.Printf("Not retrying to download %s, no telepathy service", uuid)
+		return
+	}
+	if !mmsEnabled() {
+		log.Printf("Not retrying to download %s, MMS is disabled", uuid)
+		return
+	}
+	log.Printf("Retrying to download %s, attempt %d", uuid, mmsState.Attempts+1)
+	telepathyService.RedownloadMessage(uuid)
+}
+
+// retryDownloadsNow immediately retries all stored messages of the modem, which wait for an automatic redownload.
+func (mediator *Mediator) retryDownloadsNow() {
+	modemId := mediator.modem.Identity()
+	for _, uuid := range storage.GetStoredUUIDs() {
+		mmsState, err := storage.GetMMSState(uuid)
+		if err != nil || mmsState.ModemId != modemId {
+			continue
+		}
+		if mmsState.State == storage.NOTIFICATION && !mmsState.NextAttempt.IsZero() {
+			mediator.retryDownload(uuid)
+		}
+	}
+}
+
+// watchMobileDataEnabled retries pending downloads immediately, whenever mobile data is switched on.
+func (mediator *Mediator) watchMobileDataEnabled() {
+	if mediator.telepathyService == nil {
+		return
+	}
+	watch, enabled, err := mediator.telepathyService.WatchMobileDataEnabled()
+	if err != nil {
+		log.Printf("Error watching mobile data: %v", err)
+		return
+	}
+	mediator.mobileDataWatch = watch
+	go func() {
+		for on := range enabled {
+			if on {
+				mediator.retryDownloadsNow()
+			}
+		}
+	}()
 }
 
 // Decodes previously stored message (using UpdateDownloaded) to MRetrieveConf structure.
@@ -476,10 +824,68 @@ func (mediator *Mediator) handleMNotifyRespInd(mNotifyRespInd *mms.MNotifyRespIn
 	return filePath
 }
 
+// Notifies the MMS center, that the message was retrieved.
+// If the retrieval was previously deferred, m-acknowledge.ind is sent instead of m-notifyresp.ind.
+func (mediator *Mediator) sendRetrievalResponse(mNotificationInd *mms.MNotificationInd, mRetrieveConf *mms.MRetrieveConf, mmsContext *ofono.OfonoContext) error {
+	if mNotificationInd.Deferred {
+		filePath := mediator.handleMAcknowledgeInd(mRetrieveConf.NewMAcknowledgeInd(useDeliveryReports))
+		if filePath == "" {
+			return fmt.Errorf("Getting file for m-acknowledge.ind failed")
+		}
+		if err := mediator.sendMAcknowledgeInd(filePath, mmsContext); err != nil {
+			return fmt.Errorf("error sending m-acknowledge.ind: %w", err)
+		}
+		return nil
+	}
+
+	filePath := mediator.handleMNotifyRespInd(mRetrieveConf.NewMNotifyRespInd(useDeliveryReports))
+	if filePath == "" {
+		return fmt.Errorf("Getting file for m-notifyresp.ind failed")
+	}
+	if err := mediator.sendMNotifyRespInd(filePath, mmsContext); err != nil {
+		return fmt.Errorf("error sending m-notifyresp.ind: %w", err)
+	}
+	return nil
+}
+
+func (mediator *Mediator) handleMAcknowledgeInd(mAcknowledgeInd *mms.MAcknowledgeInd) string {
+	f, err := storage.CreateAcknowledgeFile(mAcknowledgeInd.UUID)
+	if err != nil {
+		log.Print("Unable to create m-acknowledge.ind file for ", mAcknowledgeInd.UUID)
+		return ""
+	}
+	enc := mms.NewEncoder(f)
+	if err := enc.Encode(mAcknowledgeInd); err != nil {
+		log.Print("Unable to encode m-acknowledge.ind for ", mAcknowledgeInd.UUID)
+		f.Close()
+		return ""
+	}
+	filePath := f.Name()
+	if err := f.Sync(); err != nil {
+		log.Print("Error while syncing", f.Name(), ": ", err)
+		return ""
+	}
+	if err := f.Close(); err != nil {
+		log.Print("Error while closing", f.Name(), ": ", err)
+		return ""
+	}
+	log.Printf("Created %s to handle m-acknowledge.ind for %s", filePath, mAcknowledgeInd.UUID)
+	return filePath
+}
+
+func (mediator *Mediator) sendMAcknowledgeInd(filePath string, mmsContext *ofono.OfonoContext) error {
+	return uploadIndFile("m-acknowledge.ind", filePath, mmsContext)
+}
+
 func (mediator *Mediator) sendMNotifyRespInd(filePath string, mmsContext *ofono.OfonoContext) error {
+	return uploadIndFile("m-notifyresp.ind", filePath, mmsContext)
+}
+
+// Uploads the encoded pdu file to the message center and removes the file afterwards.
+func uploadIndFile(pdu, filePath string, mmsContext *ofono.OfonoContext) error {
 	defer func() {
 		if err := os.Remove(filePath); err != nil {
-			log.Printf("cannot remove m-notifyresp.ind encoded file %s: %s", filePath, err)
+			log.Printf("cannot remove %s encoded file %s: %s", pdu, filePath, err)
 		}
 	}()
 
@@ -492,71 +898,187 @@ func (mediator *Mediator) sendMNotifyRespInd(filePath string, mmsContext *ofono.
 		return fmt.Errorf("cannot retrieve MMSC setting: %w", err)
 	}
 
-	if _, err := mms.Upload(filePath, msc, proxy.Host, int32(proxy.Port)); err != nil {
-		return fmt.Errorf("cannot upload m-notifyresp.ind encoded file %s to message center: %w", filePath, err)
+	if _, err := newTransport(proxy, mmsContext).Upload(filePath, msc, nil, nil); err != nil {
+		return fmt.Errorf("cannot upload %s encoded file %s to message center: %w", pdu, filePath, err)
 	}
 
 	return nil
 }
 
+// storeMReadRecInd stores a pending read report for the retrieved message, if the originator requested one and read reports are enabled.
+// Returns the stored message state.
+func (mediator *Mediator) storeMReadRecInd(mNotificationInd *mms.MNotificationInd, mRetrieveConf *mms.MRetrieveConf) (storage.MMSState, error) {
+	if !mRetrieveConf.ReadReportRequested() || !mediator.telepathyService.UseReadReports() {
+		return storage.GetMMSState(mRetrieveConf.UUID)
+	}
+	if mNotificationInd.IsDebug() {
+		log.Print("This is a local test, skipping m-read-rec.ind")
+		return storage.GetMMSState(mRetrieveConf.UUID)
+	}
+	return storage.UpdateMReadRecInd(mRetrieveConf.UUID, mRetrieveConf.NewMReadRecInd())
+}
+
+// handleMReadRecInd encodes and sends the m-read-rec.ind to the MMS center.
+func (mediator *Mediator) handleMReadRecInd(mReadRecInd *mms.MReadRecInd) {
+	f, err := storage.CreateReadReportFile(mReadRecInd.UUID)
+	if err != nil {
+		log.Print("Unable to create m-read-rec.ind file for ", mReadRecInd.UUID)
+		return
+	}
+	filePath := f.Name()
+	defer func() {
+		if err := os.Remove(filePath); err != nil {
+			log.Printf("cannot remove m-read-rec.ind encoded file %s: %s", filePath, err)
+		}
+	}()
+	enc := mms.NewEncoder(f)
+	if err := enc.Encode(mReadRecInd); err != nil {
+		log.Print("Unable to encode m-read-rec.ind for ", mReadRecInd.UUID)
+		f.Close()
+		return
+	}
+	if err := f.Sync(); err != nil {
+		log.Print("Error while syncing", f.Name(), ": ", err)
+		return
+	}
+	if err := f.Close(); err != nil {
+		log.Print("Error while closing", f.Name(), ": ", err)
+		return
+	}
+
+	respFile, err := mediator.uploadFile(filePath, nil, nil)
+	if err != nil {
+		log.Printf("Cannot upload m-read-rec.ind encoded file %s to message center: %s", filePath, err)
+		return
+	}
+	os.Remove(respFile)
+	log.Printf("Sent m-read-rec.ind for %s", mReadRecInd.UUID)
+}
+
 func (mediator *Mediator) handleOutgoingMessage(msg *telepathy.OutgoingMessage) {
 	var cts []*mms.Attachment
 	for _, att := range msg.Attachments {
 		ct, err := mms.NewAttachment(att.Id, att.ContentType, att.FilePath)
 		if err != nil {
 			log.Print(err)
-			//TODO reply to telepathy ofono with an error
+			// Reply with a message, which failed right away, to let the client know why.
+			uuid := mms.GenUUID()
+			if _, err := mediator.telepathyService.ReplySendMessage(msg.Reply, uuid); err != nil {
+				log.Print(err)
+				return
+			}
+			mediator.endSend(uuid, telepathy.PERMANENT_ERROR, standartizedError{err, ErrorAttachment})
 			return
 		}
+		if mediator.telepathyService.StripMetadata() {
+			if err := ct.StripMetadata(); err != nil {
+				log.Printf("Cannot strip metadata of attachment %s: %v", att.Id, err)
+			}
+		}
 		cts = append(cts, ct)
 	}
-	mSendReq := mms.NewMSendReq(msg.Recipients, cts, useDeliveryReports)
+	mSendReq := mms.NewMSendReq(msg.Recipients, cts, useDeliveryReports, mediator.telepathyService.UseReadReports())
+	mSendReq.AddCc(msg.Cc...)
+	mSendReq.AddBcc(msg.Bcc...)
+	mSendReq.Subject = msg.Subject
+	mSendReq.Priority = msg.Priority
+	mSendReq.DeliveryTime = msg.DeliveryTime
+	if !msg.Expiry.IsZero() {
+		mSendReq.Expiry = msg.Expiry
+	}
+	if mediator.telepathyService.GenerateSmil() {
+		if err := mSendReq.AddSmil(); err != nil {
+			log.Print(err)
+		}
+	}
+	// Track the message before replying, so that it can be cancelled as soon as the client knows it.
+	mediator.addOutgoing(mSendReq.UUID)
 	if _, err := mediator.telepathyService.ReplySendMessage(msg.Reply, mSendReq.UUID); err != nil {
 		log.Print(err)
+		mediator.removeOutgoing(mSendReq.UUID)
 		return
 	}
 	mediator.NewMSendReq <- mSendReq
 }
 
 func (mediator *Mediator) handleMSendReq(mSendReq *mms.MSendReq) {
+	send, ok := mediator.getOutgoing(mSendReq.UUID)
+	if !ok || send.cancelled() {
+		log.Printf("Sending of %s was cancelled", mSendReq.UUID)
+		return
+	}
+	if err := mSendReq.FitSize(mediator.telepathyService.MaxMessageSize()); err != nil {
+		if _, ok := err.(mms.ErrorMessageTooLarge); ok {
+			log.Printf("Unable to fit m-send.req for %s in the maximum message size: %v", mSendReq.UUID, err)
+			mediator.endSend(mSendReq.UUID, telepathy.PERMANENT_ERROR, standartizedError{err, ErrorMessageTooLarge})
+			return
+		}
+		log.Printf("Unable to check the size of m-send.req for %s: %v", mSendReq.UUID, err)
+	}
 	log.Print("Encoding M-Send.Req")
-	f, err := storage.CreateSendFile(mSendReq.UUID)
+	f, err := storage.CreateSendFile(mediator.modem.Identity(), mSendReq.UUID, mms.AddressValues(mSendReq.Recipients()))
 	if err != nil {
 		log.Print("Unable to create m-send.req file for ", mSendReq.UUID)
+		mediator.endSend(mSendReq.UUID, telepathy.PERMANENT_ERROR, standartizedError{err, ErrorStorage})
 		return
 	}
 	defer f.Close()
 	enc := mms.NewEncoder(f)
 	if err := enc.Encode(mSendReq); err != nil {
 		log.Print("Unable to encode m-send.req for ", mSendReq.UUID)
-		if err := mediator.telepathyService.MessageStatusChanged(mSendReq.UUID, telepathy.PERMANENT_ERROR); err != nil {
-			log.Println(err)
-		}
 		f.Close()
+		mediator.endSend(mSendReq.UUID, telepathy.PERMANENT_ERROR, standartizedError{err, ErrorEncode})
 		return
 	}
 	filePath := f.Name()
 	if err := f.Sync(); err != nil {
 		log.Print("Error while syncing", f.Name(), ": ", err)
+		mediator.endSend(mSendReq.UUID, telepathy.PERMANENT_ERROR, standartizedError{err, ErrorStorage})
 		return
 	}
 	if err := f.Close(); err != nil {
 		log.Print("Error while closing", f.Name(), ": ", err)
+		mediator.endSend(mSendReq.UUID, telepathy.PERMANENT_ERROR, standartizedError{err, ErrorStorage})
 		return
 	}
 	log.Printf("Created %s to handle m-send.req for %s", filePath, mSendReq.UUID)
+	if send.cancelled() {
+		// Cancelled while encoding, the storage might have been destroyed before it was created.
+		log.Printf("Sending of %s was cancelled", mSendReq.UUID)
+		if err := storage.Destroy(mSendReq.UUID); err != nil {
+			log.Printf("Error destroying cancelled message %s: %v", mSendReq.UUID, err)
+		}
+		return
+	}
 	mediator.sendMSendReq(filePath, mSendReq.UUID)
 }
 
+// sendMSendReq uploads the stored m-send.req. Transient failures are retried later,
+// the m-send.req is kept in storage until it is sent or fails permanently.
 func (mediator *Mediator) sendMSendReq(mSendReqFile, uuid string) {
-	defer os.Remove(mSendReqFile)
-	defer mediator.telepathyService.MessageDestroy(uuid)
-	mSendConfFile, err := mediator.uploadFile(mSendReqFile)
-	if err != nil {
-		if err := mediator.telepathyService.MessageStatusChanged(uuid, telepathy.TRANSIENT_ERROR); err != nil {
-			log.Println(err)
+	send, ok := mediator.getOutgoing(uuid)
+	if !ok || send.cancelled() {
+		log.Printf("Sending of %s was cancelled", uuid)
+		return
+	}
+	telepathyService := mediator.telepathyService
+	if telepathyService == nil {
+		log.Printf("No telepathy service to send %s", uuid)
+		mediator.retrySendMSendReq(mSendReqFile, uuid, standartizedError{errNoTelepathyService, ErrorActivateContext})
+		return
+	}
+	mSendConfFile, err := mediator.uploadFile(mSendReqFile, send.cancel, telepathyService.TransferProgress(uuid))
+	if send.cancelled() {
+		// The message was removed on cancelling, whatever the upload result is.
+		log.Printf("Sending of %s was cancelled", uuid)
+		if err == nil {
+			os.Remove(mSendConfFile)
 		}
+		return
+	}
+	if err != nil {
 		log.Printf("Cannot upload m-send.req encoded file %s to message center: %s", mSendReqFile, err)
+		mediator.retrySendMSendReq(mSendReqFile, uuid, err)
 		return
 	}
 
@@ -564,27 +1086,263 @@ func (mediator *Mediator) sendMSendReq(mSendReqFile, uuid string) {
 	mSendConf, err := parseMSendConfFile(mSendConfFile)
 	if err != nil {
 		log.Println("Error while decoding m-send.conf:", err)
-		if err := mediator.telepathyService.MessageStatusChanged(uuid, telepathy.TRANSIENT_ERROR); err != nil {
-			log.Println(err)
-		}
+		mediator.retrySendMSendReq(mSendReqFile, uuid, standartizedError{err, ErrorDecodeSendConf})
 		return
 	}
 
 	log.Println("m-send.conf ResponseStatus for", uuid, "is", mSendConf.ResponseStatus)
-	var status string
+	if _, err := storage.UpdateResponse(uuid, mSendConf.ResponseStatus, mSendConf.ResponseText); err != nil {
+		log.Printf("Error updating storage (UpdateResponse) for %s: %v", uuid, err)
+	}
+	if mediator.telepathyService != nil {
+		if err := mediator.telepathyService.MessageResponseReceived(uuid, mSendConf); err != nil {
+			log.Println(err)
+		}
+	}
 	switch mSendConf.Status() {
 	case nil:
-		status = telepathy.SENT
-	case mms.ErrPermanent:
-		status = telepathy.PERMANENT_ERROR
+		// Keep track of the assigned message id to match incoming m-delivery.ind against.
+		if mmsState, err := storage.UpdateSent(uuid, mSendConf.MessageId); err != nil {
+			log.Printf("Error updating storage (UpdateSent) for %s: %v", uuid, err)
+		} else if mediator.telepathyService != nil {
+			if err := mediator.telepathyService.MessageRecipientStatusChanged(uuid, mmsState.SendState); err != nil {
+				log.Println(err)
+			}
+		}
+		if err := os.Remove(mSendReqFile); err != nil {
+			log.Printf("Error removing sent m-send.req %s: %v", mSendReqFile, err)
+		}
+		mediator.endSend(uuid, telepathy.SENT, nil)
 	case mms.ErrTransient:
-		status = telepathy.TRANSIENT_ERROR
+		mediator.retrySendMSendReq(mSendReqFile, uuid, sendConfError(mSendConf))
+	default:
+		mediator.endSend(uuid, telepathy.PERMANENT_ERROR, sendConfError(mSendConf))
+	}
+}
+
+// retrySendMSendReq schedules another attempt to send the stored m-send.req, which failed with
+// sendErr, with an exponential backoff, or gives up after maxSendAttempts.
+func (mediator *Mediator) retrySendMSendReq(mSendReqFile, uuid string, sendErr error) {
+	mmsState, err := storage.GetMMSState(uuid)
+	if err != nil {
+		log.Printf("Error retrieving state of %s to retry sending: %v", uuid, err)
+		mediator.endSend(uuid, telepathy.PERMANENT_ERROR, standartizedError{err, ErrorStorage})
+		return
+	}
+	if mmsState.Attempts+1 >= maxSendAttempts {
+		log.Printf("Giving up sending %s after %d attempts", uuid, mmsState.Attempts+1)
+		mediator.endSend(uuid, telepathy.PERMANENT_ERROR, sendErr)
+		return
+	}
+
+	delay := retryDelay(mmsState.Attempts, sendRetryInitialDelay, sendRetryMaxDelay)
+	if _, err := storage.UpdateAttempt(uuid, time.Now().Add(delay)); err != nil {
+		log.Printf("Error updating storage (UpdateAttempt) for %s: %v", uuid, err)
+	}
+	mediator.reportSendStatus(uuid, telepathy.TRANSIENT_ERROR, sendErr)
+	log.Printf("Retrying to send %s in %s", uuid, delay)
+	mediator.scheduleSendMSendReq(mSendReqFile, uuid, delay)
+}
+
+func (mediator *Mediator) scheduleSendMSendReq(mSendReqFile, uuid string, delay time.Duration) {
+	mediator.outgoingLock.Lock()
+	defer mediator.outgoingLock.Unlock()
+	send, ok := mediator.outgoing[uuid]
+	if !ok {
+		log.Printf("Not scheduling to send %s, it was cancelled", uuid)
+		return
+	}
+	if send.retry != nil {
+		send.retry.Stop()
+	}
+	send.retry = time.AfterFunc(delay, func() {
+		mediator.NewMSendReqFile <- struct{ filePath, uuid string }{mSendReqFile, uuid}
+	})
+}
+
+// retryDelay returns the delay before the next attempt of a transfer, which failed attempts times.
+// The delay starts at initial and doubles with each attempt, up to max.
+func retryDelay(attempts int, initial, max time.Duration) time.Duration {
+	if attempts >= 32 {
+		return max
+	}
+	if delay := initial << uint(attempts); delay > 0 && delay < max {
+		return delay
+	}
+	return max
+}
+
+// withJitter randomly shortens or prolongs delay by up to retryJitter of it, so that retries of several
+// messages don't happen all at once.
+func withJitter(delay time.Duration) time.Duration {
+	jitterLock.Lock()
+	defer jitterLock.Unlock()
+	return delay + time.Duration((jitterRand.Float64()*2-1)*retryJitter*float64(delay))
+}
+
+// endSend reports the final status of the outgoing message identified by uuid, and the error it
+// failed with, to telepathy and stops handling it. Messages which weren't sent are removed from storage.
+func (mediator *Mediator) endSend(uuid, status string, sendErr error) {
+	mediator.removeOutgoing(uuid)
+	mediator.reportSendStatus(uuid, status, sendErr)
+	if _, err := storage.GetMMSState(uuid); err == nil && status != telepathy.SENT {
+		if err := storage.Destroy(uuid); err != nil {
+			log.Printf("Error destroying unsent message %s: %v", uuid, err)
+		}
 	}
-	if err := mediator.telepathyService.MessageStatusChanged(uuid, status); err != nil {
+	if mediator.telepathyService != nil {
+		if err := mediator.telepathyService.MessageDestroy(uuid); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// reportSendStatus reports status of the outgoing message identified by uuid to telepathy.
+// A non nil sendErr is reported in the Error property of the message.
+func (mediator *Mediator) reportSendStatus(uuid, status string, sendErr error) {
+	if mediator.telepathyService == nil {
+		log.Printf("No telepathy service to report status %s of %s", status, uuid)
+		return
+	}
+	var err error
+	switch {
+	case sendErr == nil:
+		err = mediator.telepathyService.MessageStatusChanged(uuid, status)
+	case status == telepathy.TRANSIENT_ERROR:
+		err = mediator.telepathyService.MessageSendDelayed(uuid, sendErr)
+	default:
+		err = mediator.telepathyService.MessageSendFailed(uuid, sendErr)
+	}
+	if err != nil {
 		log.Println(err)
 	}
 }
 
+// handleSendCancel cancels the sending of the outgoing message identified by uuid, stopping the
+// upload or the scheduled retry, and removes it. Messages not being sent are just removed.
+func (mediator *Mediator) handleSendCancel(uuid string) {
+	send, ok := mediator.removeOutgoing(uuid)
+	if ok {
+		log.Printf("Cancelling sending of %s", uuid)
+		close(send.cancel)
+		if send.retry != nil {
+			send.retry.Stop()
+		}
+		mediator.reportSendStatus(uuid, telepathy.CANCELLED, nil)
+	}
+	if mediator.telepathyService == nil {
+		log.Printf("No telepathy service to remove %s", uuid)
+		return
+	}
+
+	msgObjectPath := mediator.telepathyService.GenMessagePath(uuid)
+	if _, err := storage.GetMMSState(uuid); ok && err != nil {
+		// Still queued, there is nothing in storage to remove yet.
+		if err := mediator.telepathyService.MessageDestroy(uuid); err != nil {
+			log.Println(err)
+		}
+		if err := mediator.telepathyService.SingnalMessageRemoved(msgObjectPath); err != nil {
+			log.Print("Failed to signal removal of ", msgObjectPath, ": ", err)
+		}
+		return
+	}
+	if err := mediator.telepathyService.MessageRemoved(msgObjectPath); err != nil {
+		log.Print("Failed to delete ", msgObjectPath, ": ", err)
+	}
+}
+
+// handleDownloadCancel aborts the redownload in progress of the incoming message identified by uuid.
+// The message is stored again, the error is communicated to telepathy and it can be redownloaded.
+func (mediator *Mediator) handleDownloadCancel(uuid string) {
+	cancel, ok := mediator.removeDownload(uuid)
+	if !ok {
+		log.Printf("Can't cancel download of %s, it is not in progress", uuid)
+		return
+	}
+	log.Printf("Cancelling download of %s", uuid)
+	close(cancel)
+}
+
+// addDownload returns the channel cancelling the download of mNotificationInd. Only redownloads can be
+// cancelled, by the message redownloaded, which the client knows. Other downloads get a nil channel.
+func (mediator *Mediator) addDownload(mNotificationInd *mms.MNotificationInd) <-chan struct{} {
+	if mNotificationInd.RedownloadOfUUID == "" {
+		return nil
+	}
+	mediator.downloadsLock.Lock()
+	defer mediator.downloadsLock.Unlock()
+	cancel := make(chan struct{})
+	mediator.downloads[mNotificationInd.RedownloadOfUUID] = cancel
+	return cancel
+}
+
+func (mediator *Mediator) removeDownload(uuid string) (chan struct{}, bool) {
+	mediator.downloadsLock.Lock()
+	defer mediator.downloadsLock.Unlock()
+	cancel, ok := mediator.downloads[uuid]
+	delete(mediator.downloads, uuid)
+	return cancel, ok
+}
+
+func (mediator *Mediator) addOutgoing(uuid string) {
+	mediator.outgoingLock.Lock()
+	defer mediator.outgoingLock.Unlock()
+	if _, ok := mediator.outgoing[uuid]; !ok {
+		mediator.outgoing[uuid] = &outgoingSend{cancel: make(chan struct{})}
+	}
+}
+
+func (mediator *Mediator) getOutgoing(uuid string) (*outgoingSend, bool) {
+	mediator.outgoingLock.Lock()
+	defer mediator.outgoingLock.Unlock()
+	send, ok := mediator.outgoing[uuid]
+	return send, ok
+}
+
+// stopSendRetries stops the scheduled attempts to send the outgoing messages. The messages stay in
+// storage and are resumed once a telepathy service is added again.
+func (mediator *Mediator) stopSendRetries() {
+	mediator.outgoingLock.Lock()
+	defer mediator.outgoingLock.Unlock()
+	for _, send := range mediator.outgoing {
+		if send.retry != nil {
+			send.retry.Stop()
+			send.retry = nil
+		}
+	}
+}
+
+func (mediator *Mediator) removeOutgoing(uuid string) (*outgoingSend, bool) {
+	mediator.outgoingLock.Lock()
+	defer mediator.outgoingLock.Unlock()
+	send, ok := mediator.outgoing[uuid]
+	delete(mediator.outgoing, uuid)
+	return send, ok
+}
+
+// resumeMSendReq schedules the sending of an outgoing message, which was stored before a restart.
+func (mediator *Mediator) resumeMSendReq(uuid string, mmsState storage.MMSState) {
+	filePath, err := storage.GetSendFile(uuid)
+	if err != nil {
+		log.Printf("Outgoing message %s has no m-send.req to send, deleting", uuid)
+		if err := storage.Destroy(uuid); err != nil {
+			log.Printf("Error destroying outgoing message: %v", err)
+		}
+		return
+	}
+	if _, err := mediator.telepathyService.OutgoingMessageRestored(uuid); err != nil {
+		log.Printf("Error restoring outgoing message %s: %v", uuid, err)
+	}
+	mediator.addOutgoing(uuid)
+
+	delay := time.Until(mmsState.NextAttempt)
+	if delay < 0 {
+		delay = 0
+	}
+	log.Printf("Resuming to send %s in %s", uuid, delay)
+	mediator.scheduleSendMSendReq(filePath, uuid, delay)
+}
+
 func parseMSendConfFile(mSendConfFile string) (*mms.MSendConf, error) {
 	b, err := ioutil.ReadFile(mSendConfFile)
 	if err != nil {
@@ -600,31 +1358,79 @@ func parseMSendConfFile(mSendConfFile string) (*mms.MSendConf, error) {
 	return mSendConf, nil
 }
 
-func (mediator *Mediator) uploadFile(filePath string) (string, error) {
+func (mediator *Mediator) uploadFile(filePath string, cancel <-chan struct{}, progress mms.ProgressFunc) (string, error) {
 	mediator.contextLock.Lock()
 	defer mediator.contextLock.Unlock()
 
+	select {
+	case <-cancel:
+		return "", mms.ErrCancelled
+	default:
+	}
+
+	telepathyService := mediator.telepathyService
+	if telepathyService == nil {
+		return "", standartizedError{errNoTelepathyService, ErrorActivateContext}
+	}
 	mmsContext, deactivateMMSContext, err := mediator.activateMMSContext()
 	if err != nil {
-		return "", err
+		return "", standartizedError{err, ErrorActivateContext}
 	}
 	defer deactivateMMSContext()
 
-	if err := mediator.telepathyService.SetPreferredContext(mmsContext.ObjectPath); err != nil {
+	if err := telepathyService.SetPreferredContext(mmsContext.ObjectPath); err != nil {
 		log.Println("Unable to store the preferred context for MMS:", err)
 	}
 
 	proxy, err := mmsContext.GetProxy()
 	if err != nil {
-		return "", err
+		return "", standartizedError{err, ErrorGetProxy}
 	}
 	msc, err := mmsContext.GetMessageCenter()
 	if err != nil {
-		return "", err
+		return "", standartizedError{err, ErrorGetMessageCenter}
+	}
+	mSendRespFile, err := newTransport(proxy, &mmsContext).Upload(filePath, msc, cancel, progress)
+	if err != nil {
+		return "", uploadError(err)
 	}
-	mSendRespFile, uploadErr := mms.Upload(filePath, msc, proxy.Host, int32(proxy.Port))
+	return mSendRespFile, nil
+}
 
-	return mSendRespFile, uploadErr
+// newTransport returns the transport uploading to the MMS center through proxy from the network interface of
+// mmsContext. The udm transport is used, unless the transportEnv environment variable is set to "http".
+func newTransport(proxy ofono.ProxyInfo, mmsContext *ofono.OfonoContext) mms.Transport {
+	if os.Getenv(transportEnv) != "http" {
+		return mms.NewUDMTransport(proxy.Host, int32(proxy.Port))
+	}
+	return newHTTPTransport(proxy, mmsContext)
+}
+
+// newDownloadTransport returns the transport downloading from the MMS center through proxy from the network
+// interface of mmsContext. The net/http transport is used, so that interrupted downloads are resumed, unless
+// the transportEnv environment variable is set to "udm".
+func newDownloadTransport(proxy ofono.ProxyInfo, mmsContext *ofono.OfonoContext) mms.Transport {
+	if os.Getenv(transportEnv) == "udm" {
+		return mms.NewUDMTransport(proxy.Host, int32(proxy.Port))
+	}
+	return newHTTPTransport(proxy, mmsContext)
+}
+
+func newHTTPTransport(proxy ofono.ProxyInfo, mmsContext *ofono.OfonoContext) mms.Transport {
+	iface, err := mmsContext.GetInterface()
+	if err != nil {
+		log.Printf("Not binding to the interface of the MMS context: %v", err)
+	}
+	dir, err := storage.GetTransferDir()
+	if err != nil {
+		log.Printf("Unable to get the transfer directory, using the temporary one: %v", err)
+	}
+	transport, err := mms.NewHTTPTransport(proxy.Host, int32(proxy.Port), iface, dir)
+	if err != nil {
+		log.Printf("Not binding to interface %s of the MMS context: %v", iface, err)
+		transport, _ = mms.NewHTTPTransport(proxy.Host, int32(proxy.Port), "", dir)
+	}
+	return transport
 }
 
 // By default this method returns true, unless it is strictly requested to disable.
@@ -673,6 +1479,19 @@ func (mediator *Mediator) initializeMessages(modemId string) {
 			continue
 		}
 
+		if mmsState.State == storage.DRAFT && (mmsState.ModemId == modemId || mmsState.ModemId == "") {
+			mediator.resumeMSendReq(uuid, mmsState)
+			continue
+		}
+
+		if mmsState.State == storage.SENT && time.Since(mmsState.Sent) > sentRetention {
+			log.Printf("Message %s was sent more than %s ago, deleting", uuid, sentRetention)
+			if err := storage.Destroy(uuid); err != nil {
+				log.Printf("Error destroying sent message: %v", err)
+			}
+			continue
+		}
+
 		if !mmsState.IsIncoming() {
 			log.Printf("Message %s is not an incoming message. State: %s", uuid, mmsState.State)
 			continue
@@ -739,6 +1558,17 @@ func (mediator *Mediator) initializeMessages(modemId string) {
 			// Message download failed, error was probably communicated to telepathy.
 			// It is now up to user to initiate redownload or there is a possibility, that a new notification with the same TransactionId arrives from MMS center.
 
+			if mmsState.MNotificationInd.Deferred && mmsState.TelepathyErrorNotified == false {
+				// Message download was deferred and telepathy was notified about it. It is up to user to initiate download.
+				if checkExpiredAndHandle() {
+					delete(mediator.unrespondedTransactions, mmsState.MNotificationInd.TransactionId)
+					break
+				}
+
+				startTelepathyHandlers = true
+				break
+			}
+
 			if mmsState.TelepathyErrorNotified == false { // Telepathy service wasn't notified of the download error.
 				// Handle as new MNotificationInd and send to NewMNotificationInd channel.
 				go func() {
@@ -772,6 +1602,11 @@ func (mediator *Mediator) initializeMessages(modemId string) {
 				} else {
 					// Message was forwarded to telepathy and state in storage was updated.
 					forwardedUpdated = true
+					if st, err := mediator.storeMReadRecInd(mmsState.MNotificationInd, mRetrieveConf); err != nil {
+						log.Println("Error updating storage (UpdateMReadRecInd): ", err)
+					} else {
+						mmsState = st
+					}
 					// If this message falls through to RESPONDED, don't check if message is in history service, cause it probably hasn't arrived there yet.
 					checkInHistoryService = false
 				}
@@ -838,6 +1673,9 @@ func (mediator *Mediator) initializeMessages(modemId string) {
 					if isnew, err := hsMessage.IsNew(); err != nil {
 						log.Printf("Error checking if message is new in HistoryService: %s", err)
 					} else if isnew == false {
+						if mmsState.MReadRecInd != nil {
+							go mediator.handleMReadRecInd(mmsState.MReadRecInd)
+						}
 						log.Printf("Message %s is marked as read in HistoryService, no need to store, deleting.", uuid)
 						if err := storage.Destroy(uuid); err != nil {
 							log.Printf("Error destroying message: %v", err)
@@ -859,6 +1697,10 @@ func (mediator *Mediator) initializeMessages(modemId string) {
 			if err := mediator.telepathyService.InitializationMessageAdded(mRetrieveConf, mmsState.MNotificationInd); err != nil {
 				log.Printf("Error adding initialization message for message %s: %v", uuid, err)
 			}
+			if mmsState.State == storage.NOTIFICATION && !mmsState.NextAttempt.IsZero() {
+				// Resume the automatic redownload, scheduled before nuntium stopped.
+				mediator.retryDownloadAt(uuid, mmsState.NextAttempt)
+			}
 		}
 	}
 
@@ -874,7 +1716,6 @@ func (mediator *Mediator) respondMessage(mmsState storage.MMSState) error {
 		return err
 	}
 	// Notify MMS center about successful download.
-	mNotifyRespInd := mRetrieveConf.NewMNotifyRespInd(useDeliveryReports)
 	if !mmsState.MNotificationInd.IsDebug() {
 		mmsContext, deactivateMMSContext, err := mediator.activateMMSContext()
 		if err != nil {
@@ -883,13 +1724,8 @@ func (mediator *Mediator) respondMessage(mmsState storage.MMSState) error {
 		if deactivateMMSContext != nil {
 			defer deactivateMMSContext()
 		}
-		// TODO deferred case
-		filePath := mediator.handleMNotifyRespInd(mNotifyRespInd)
-		if filePath == "" {
-			return fmt.Errorf("Getting file for m-notifyresp.ind failed")
-		}
-		if err := mediator.sendMNotifyRespInd(filePath, &mmsContext); err != nil {
-			return fmt.Errorf("error sending m-notifyresp.ind: %w", err)
+		if err := mediator.sendRetrievalResponse(mmsState.MNotificationInd, mRetrieveConf, &mmsContext); err != nil {
+			return err
 		}
 	} else {
 		log.Print("This is a local test, skipping m-notifyresp.ind")
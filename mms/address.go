@@ -0,0 +1,86 @@
+package mms
+
+import (
+	"net"
+	"strings"
+)
+
+// AddressType is the type of an address as described in the addressing model
+// of OMA-WAP-MMS-ENC-v1.1 section 8.
+type AddressType string
+
+const (
+	AddressTypePLMN  AddressType = "PLMN"
+	AddressTypeIPv4  AddressType = "IPv4"
+	AddressTypeIPv6  AddressType = "IPv6"
+	AddressTypeEmail AddressType = "email"
+)
+
+const addressTypeSeparator = "/TYPE="
+
+// Address is a recipient or originator address of a message.
+type Address struct {
+	Value string
+	Type  AddressType
+}
+
+// NewAddress classifies recipient as an email, IPv4 or IPv6 address and else
+// as a phone number or short code. Already encoded recipients are decoded.
+func NewAddress(recipient string) Address {
+	recipient = strings.TrimSpace(recipient)
+	if strings.Contains(recipient, addressTypeSeparator) {
+		return DecodeAddress(recipient)
+	}
+	switch ip := net.ParseIP(recipient); {
+	case strings.Contains(recipient, "@"):
+		return Address{recipient, AddressTypeEmail}
+	case ip != nil && ip.To4() != nil:
+		return Address{recipient, AddressTypeIPv4}
+	case ip != nil:
+		return Address{recipient, AddressTypeIPv6}
+	}
+	return Address{recipient, AddressTypePLMN}
+}
+
+// DecodeAddress parses an address as encoded in the address headers. Addresses
+// without a type are classified as in NewAddress.
+func DecodeAddress(encoded string) Address {
+	i := strings.LastIndex(encoded, addressTypeSeparator)
+	if i < 0 {
+		return NewAddress(encoded)
+	}
+	a := Address{Value: encoded[:i], Type: AddressType(encoded[i+len(addressTypeSeparator):])}
+	for _, t := range []AddressType{AddressTypePLMN, AddressTypeIPv4, AddressTypeIPv6} {
+		if strings.EqualFold(string(a.Type), string(t)) {
+			a.Type = t
+		}
+	}
+	return a
+}
+
+// Encode returns the address as encoded in the address headers, emails are
+// kept as is and any other address is followed by its type.
+func (a Address) Encode() string {
+	if a.Type == AddressTypeEmail {
+		return a.Value
+	}
+	return a.Value + addressTypeSeparator + string(a.Type)
+}
+
+// EncodeAddresses returns recipients classified by NewAddress and encoded.
+func EncodeAddresses(recipients []string) []string {
+	encoded := make([]string, len(recipients))
+	for i := range recipients {
+		encoded[i] = NewAddress(recipients[i]).Encode()
+	}
+	return encoded
+}
+
+// AddressValues returns the values of the encoded addresses, without their types.
+func AddressValues(encoded []string) []string {
+	values := make([]string, len(encoded))
+	for i := range encoded {
+		values[i] = DecodeAddress(encoded[i]).Value
+	}
+	return values
+}
@@ -0,0 +1,56 @@
+package mms
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewAddress(t *testing.T) {
+	testCases := []struct {
+		recipient string
+		want      Address
+		encoded   string
+	}{
+		{"+12345678", Address{"+12345678", AddressTypePLMN}, "+12345678/TYPE=PLMN"},
+		{"2222", Address{"2222", AddressTypePLMN}, "2222/TYPE=PLMN"},
+		{" user@example.com ", Address{"user@example.com", AddressTypeEmail}, "user@example.com"},
+		{"192.168.0.1", Address{"192.168.0.1", AddressTypeIPv4}, "192.168.0.1/TYPE=IPv4"},
+		{"2001:db8::1", Address{"2001:db8::1", AddressTypeIPv6}, "2001:db8::1/TYPE=IPv6"},
+		{"+12345678/TYPE=PLMN", Address{"+12345678", AddressTypePLMN}, "+12345678/TYPE=PLMN"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.recipient, func(t *testing.T) {
+			got := NewAddress(tc.recipient)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("NewAddress = %#v, want %#v", got, tc.want)
+			}
+			if encoded := got.Encode(); encoded != tc.encoded {
+				t.Errorf("Encode = %q, want %q", encoded, tc.encoded)
+			}
+		})
+	}
+}
+
+func TestDecodeAddress(t *testing.T) {
+	testCases := []struct {
+		encoded string
+		want    Address
+	}{
+		{"+12345678/TYPE=PLMN", Address{"+12345678", AddressTypePLMN}},
+		{"+12345678/TYPE=plmn", Address{"+12345678", AddressTypePLMN}},
+		{"10.0.0.1/TYPE=IPV4", Address{"10.0.0.1", AddressTypeIPv4}},
+		{"::1/TYPE=IPv6", Address{"::1", AddressTypeIPv6}},
+		{"Operator/TYPE=ALPHANUMERIC", Address{"Operator", AddressType("ALPHANUMERIC")}},
+		{"user@example.com", Address{"user@example.com", AddressTypeEmail}},
+		{"+12345678", Address{"+12345678", AddressTypePLMN}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.encoded, func(t *testing.T) {
+			if got := DecodeAddress(tc.encoded); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("DecodeAddress = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"io/ioutil"
 	"log"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -52,7 +53,12 @@ type Attachment struct {
 	Offset           int     `encode:"no"`
 	Secure           bool    `encode:"no"`
 	Q                float64 `encode:"no"`
-	Data             []byte  `encode:"no"`
+	// Params holds the untyped content type parameters, and the well known
+	// ones without a field, by their lower case name.
+	Params map[string]string `encode:"no"`
+	// Parts holds the parts of a multipart body, Data still holds the whole body.
+	Parts []Attachment `encode:"no"`
+	Data  []byte       `encode:"no"`
 }
 
 func NewAttachment(id, contentType, filePath string) (*Attachment, error) {
@@ -81,6 +87,11 @@ func NewAttachment(id, contentType, filePath string) (*Attachment, error) {
 		}
 	}
 
+	if strings.HasPrefix(ct.MediaType, "text/") && ct.Charset == "" {
+		// Text is handed to us as UTF-8, make it explicit so that it isn't taken as us-ascii.
+		ct.Charset = "utf-8"
+	}
+
 	if contentType == "application/smil" {
 		start, err := getSmilStart(data)
 		if err != nil {
@@ -105,82 +116,202 @@ func getSmilStart(smilData []byte) (string, error) {
 
 //GetSmil returns the text corresponding to the ContentType that holds the SMIL
 func (pdu *MRetrieveConf) GetSmil() (string, error) {
-	for i := range pdu.Attachments {
-		if strings.HasPrefix(pdu.Attachments[i].MediaType, "application/smil") {
-			return string(pdu.Attachments[i].Data), nil
+	parts := flattenParts(pdu.Attachments)
+	if i := smilPart(parts, pdu.Content.Start); i >= 0 {
+		smil, err := DecodeCharset(parts[i].Data, parts[i].Charset)
+		if err != nil {
+			log.Printf("Decoding SMIL: %v", err)
 		}
+		return smil, nil
 	}
 	return "", errors.New("cannot find SMIL data part")
 }
 
-//GetDataParts returns the non SMIL ContentType data parts
+// smilPart returns the index of the SMIL part in parts, which is the start part
+// if it is SMIL and otherwise the first SMIL part, or -1 if there is none.
+func smilPart(parts []Attachment, start string) int {
+	if start != "" {
+		for i := range parts {
+			if parts[i].ContentId == start && parts[i].isSmil() {
+				return i
+			}
+		}
+	}
+	for i := range parts {
+		if parts[i].isSmil() {
+			return i
+		}
+	}
+	return -1
+}
+
+// flattenParts returns the parts holding data in the multipart tree of parts,
+// in the order they appear in the message.
+func flattenParts(parts []Attachment) []Attachment {
+	var leaves []Attachment
+	for i := range parts {
+		if len(parts[i].Parts) > 0 {
+			leaves = append(leaves, flattenParts(parts[i].Parts)...)
+			continue
+		}
+		leaves = append(leaves, parts[i])
+	}
+	return leaves
+}
+
+func (a *Attachment) isSmil() bool {
+	return strings.HasPrefix(a.MediaType, "application/smil")
+}
+
+// baseMediaType returns mediaType in lower case without its parameters.
+func baseMediaType(mediaType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(mediaType, ";")[0]))
+}
+
+// IsMultipart returns true if the attachment holds a multipart body.
+func (a *Attachment) IsMultipart() bool {
+	return strings.HasPrefix(a.MediaType, "multipart/") ||
+		strings.HasPrefix(a.MediaType, "application/vnd.wap.multipart.")
+}
+
+// PartName returns the file name of the attachment as given by its filename or
+// name content type parameters, or its content location if there are none.
+func (a *Attachment) PartName() string {
+	switch {
+	case a.FileName != "":
+		return a.FileName
+	case a.Name != "":
+		return a.Name
+	}
+	return a.ContentLocation
+}
+
+// IsText returns true if the attachment holds plain text.
+func (a *Attachment) IsText() bool {
+	return strings.HasPrefix(a.MediaType, "text/plain")
+}
+
+// Text returns the attachment data transcoded to UTF-8 according to its Charset.
+// If the charset is unknown or unsupported, the data is interpreted as UTF-8 and a non nil error is returned along.
+func (a *Attachment) Text() (string, error) {
+	return DecodeCharset(a.Data, a.Charset)
+}
+
+//GetDataParts returns the non SMIL ContentType data parts, the parts of nested
+//multiparts are returned in place of the multipart holding them.
 func (pdu *MRetrieveConf) GetDataParts() []Attachment {
 	var dataParts []Attachment
-	for i := range pdu.Attachments {
-		if pdu.Attachments[i].MediaType == "application/smil" {
+	for _, part := range flattenParts(pdu.Attachments) {
+		if part.isSmil() {
 			continue
 		}
-		dataParts = append(dataParts, pdu.Attachments[i])
+		dataParts = append(dataParts, part)
 	}
 	return dataParts
 }
 
 func (dec *MMSDecoder) ReadAttachmentParts(reflectedPdu *reflect.Value) error {
-	var err error
-	var parts uint64
-	if parts, err = dec.ReadUintVar(nil, ""); err != nil {
+	dataParts, err := dec.readParts()
+	if err != nil {
 		return err
 	}
+	reflectedPdu.FieldByName("Attachments").Set(reflect.ValueOf(dataParts))
+	return nil
+}
+
+// maxMultipartDepth limits the nesting of multipart bodies decoded into Parts,
+// deeper ones are kept as opaque parts.
+const maxMultipartDepth = 8
+
+// readParts reads the parts of a multipart body as described in section 8.5 of
+// WAP-230-WSP-20010705-a.
+func (dec *MMSDecoder) readParts() ([]Attachment, error) {
+	return dec.readMultipart(len(dec.Data)-1, 0)
+}
+
+// readMultipart reads the parts of a multipart body ending at end, the parts of
+// nested multipart bodies are read into the Parts of their enclosing part.
+func (dec *MMSDecoder) readMultipart(end, depth int) ([]Attachment, error) {
+	parts, err := dec.ReadUintVar(nil, "")
+	if err != nil {
+		return nil, err
+	}
 	var dataParts []Attachment
 	dec.log = dec.log + fmt.Sprintf("Number of parts: %d\n", parts)
 	for i := uint64(0); i < parts; i++ {
 		headerLen, err := dec.ReadUintVar(nil, "")
 		if err != nil {
-			return err
+			return nil, err
 		}
 		dataLen, err := dec.ReadUintVar(nil, "")
 		if err != nil {
-			return err
+			return nil, err
+		}
+		headerEnd, err := dec.endOffset(headerLen)
+		if err != nil {
+			return nil, err
 		}
-		headerEnd := dec.Offset + int(headerLen)
 		dec.log = dec.log + fmt.Sprintf("Attachament len(header): %d - len(data) %d\n", headerLen, dataLen)
 		var ct Attachment
 		ct.Offset = headerEnd + 1
-		ctReflected := reflect.ValueOf(&ct).Elem()
-		if err := dec.ReadAttachment(&ctReflected); err == nil {
-			if err := dec.ReadMMSHeaders(&ctReflected, headerEnd); err != nil {
-				return err
+		if err := dec.readContentType(&ct); err == nil {
+			if err := dec.readPartHeaders(&ct, headerEnd); err != nil {
+				return nil, err
 			}
 		} else if err != nil && err.Error() != "WAP message" { //TODO create error type
-			return err
+			return nil, err
 		}
-		dec.Offset = headerEnd + 1
-		if _, err := dec.ReadBoundedBytes(&ctReflected, "Data", dec.Offset+int(dataLen)); err != nil {
-			return err
+		dec.Offset = headerEnd
+		dataEnd, err := dec.endOffset(dataLen)
+		if err != nil {
+			return nil, err
+		}
+		if dataEnd > end {
+			return nil, ErrorDecodeShortData{end + 1, dataEnd}
+		}
+		dec.Offset++
+		if ct.Data, err = dec.ReadBoundedBytes(nil, "", dataEnd+1); err != nil {
+			return nil, err
 		}
 		if ct.MediaType == "application/smil" || strings.HasPrefix(ct.MediaType, "text/plain") || ct.MediaType == "" {
 			dec.log = dec.log + fmt.Sprintf("%s\n", ct.Data)
 		}
+		if ct.IsMultipart() && depth < maxMultipartDepth {
+			dec.Offset = headerEnd
+			if ct.Parts, err = dec.readMultipart(dataEnd, depth+1); err != nil {
+				log.Printf("Cannot decode nested %s, keeping it as a single part: %v", ct.MediaType, err)
+				ct.Parts = nil
+			}
+			dec.Offset = dataEnd
+		}
 		if ct.Charset != "" {
 			ct.MediaType = ct.MediaType + ";charset=" + ct.Charset
 		}
 		dataParts = append(dataParts, ct)
 	}
-	dataPartsR := reflect.ValueOf(dataParts)
-	reflectedPdu.FieldByName("Attachments").Set(dataPartsR)
-
-	return nil
+	return dataParts, nil
 }
 
 func (dec *MMSDecoder) ReadMMSHeaders(ctMember *reflect.Value, headerEnd int) error {
+	a, err := attachmentOf(ctMember)
+	if err != nil {
+		return err
+	}
+	return dec.readPartHeaders(a, headerEnd)
+}
+
+// readPartHeaders reads the headers of a multipart entry up to headerEnd.
+func (dec *MMSDecoder) readPartHeaders(a *Attachment, headerEnd int) error {
 	for dec.Offset < headerEnd {
-		var err error
-		param, _ := dec.ReadInteger(nil, "")
+		param, err := dec.ReadInteger(nil, "")
+		if err != nil {
+			return err
+		}
 		switch param {
 		case MMS_PART_CONTENT_LOCATION:
-			_, err = dec.ReadString(ctMember, "ContentLocation")
+			a.ContentLocation, err = dec.ReadString(nil, "")
 		case MMS_PART_CONTENT_ID:
-			_, err = dec.ReadString(ctMember, "ContentId")
+			a.ContentId, err = dec.ReadString(nil, "")
 		default:
 			break
 		}
@@ -192,100 +323,166 @@ func (dec *MMSDecoder) ReadMMSHeaders(ctMember *reflect.Value, headerEnd int) er
 }
 
 func (dec *MMSDecoder) ReadAttachment(ctMember *reflect.Value) error {
-	if dec.Offset+1 >= len(dec.Data) {
-		return fmt.Errorf("message ended prematurely, offset: %d and payload length is %d", dec.Offset, len(dec.Data))
+	a, err := attachmentOf(ctMember)
+	if err != nil {
+		return err
 	}
-	// These call the same function
-	if next := dec.Data[dec.Offset+1]; next&SHORT_FILTER != 0 {
-		return dec.ReadMediaType(ctMember, "MediaType")
-	} else if next >= TEXT_MIN && next <= TEXT_MAX {
-		return dec.ReadMediaType(ctMember, "MediaType")
+	return dec.readContentType(a)
+}
+
+// attachmentOf returns the Attachment held by ctMember.
+func attachmentOf(ctMember *reflect.Value) (*Attachment, error) {
+	if ctMember.CanAddr() {
+		if a, ok := ctMember.Addr().Interface().(*Attachment); ok {
+			return a, nil
+		}
 	}
+	return nil, fmt.Errorf("cannot decode content type into %s", ctMember.Type())
+}
 
-	var err error
-	var length uint64
-	if length, err = dec.ReadLength(ctMember); err != nil {
+// readContentType reads a Content-type-value with its parameters as described in
+// section 8.4.2.24 of WAP-230-WSP-20010705-a into a.
+func (dec *MMSDecoder) readContentType(a *Attachment) (err error) {
+	if err := dec.ensure(1); err != nil {
+		return err
+	}
+	// Constrained-media has no parameters
+	if next := dec.Data[dec.Offset+1]; next&SHORT_FILTER != 0 || (next >= TEXT_MIN && next <= TEXT_MAX) {
+		a.MediaType, err = dec.readMediaType()
+		return err
+	}
+
+	if a.Length, err = dec.ReadLength(nil); err != nil {
+		return err
+	}
+	dec.log = dec.log + fmt.Sprintf("Content Type Length: %d\n", a.Length)
+	endOffset, err := dec.endOffset(a.Length)
+	if err != nil {
 		return err
 	}
-	dec.log = dec.log + fmt.Sprintf("Content Type Length: %d\n", length)
-	endOffset := int(length) + dec.Offset
 
-	if err := dec.ReadMediaType(ctMember, "MediaType"); err != nil {
+	if a.MediaType, err = dec.readMediaType(); err != nil {
 		return err
 	}
+	if err := dec.readContentTypeParams(a, endOffset); err != nil {
+		return err
+	}
+	dec.Offset = endOffset
+	return nil
+}
 
-	for dec.Offset < len(dec.Data) && dec.Offset < endOffset {
-		param, _ := dec.ReadInteger(nil, "")
+// readContentTypeParams reads the parameters of a Content-general-form up to
+// endOffset as described in section 8.4.2.4 of WAP-230-WSP-20010705-a.
+//
+// Well known parameters are set on their Attachment field, untyped parameters
+// and well known ones a has no field for are kept in a.Params.
+func (dec *MMSDecoder) readContentTypeParams(a *Attachment, endOffset int) error {
+	for dec.Offset < endOffset {
+		// Untyped-parameter = Token-text Untyped-value
+		if next := dec.Data[dec.Offset+1]; next >= TEXT_MIN && next <= TEXT_MAX {
+			name, err := dec.ReadString(nil, "")
+			if err != nil {
+				return err
+			}
+			value, err := dec.readUntypedValue()
+			if err != nil {
+				return err
+			}
+			a.setParam(name, value)
+			continue
+		}
+
+		param, err := dec.ReadInteger(nil, "")
+		if err != nil {
+			return err
+		}
 		switch param {
 		case WSP_PARAMETER_TYPE_Q:
-			err = dec.ReadQ(ctMember)
+			a.Q, err = dec.readQ()
 		case WSP_PARAMETER_TYPE_CHARSET:
-			_, err = dec.ReadCharset(ctMember, "Charset")
+			a.Charset, err = dec.ReadCharset(nil, "")
 		case WSP_PARAMETER_TYPE_LEVEL:
-			_, err = dec.ReadShortInteger(ctMember, "Level")
+			a.Level, err = dec.readVersion()
 		case WSP_PARAMETER_TYPE_TYPE:
-			_, err = dec.ReadInteger(ctMember, "Type")
+			var t uint64
+			if t, err = dec.ReadInteger(nil, ""); err == nil && t < uint64(len(CONTENT_TYPES)) {
+				a.Type = CONTENT_TYPES[t]
+			}
 		case WSP_PARAMETER_TYPE_NAME_DEFUNCT:
 			log.Println("Using deprecated Name header")
-			_, err = dec.ReadString(ctMember, "Name")
+			a.Name, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_FILENAME_DEFUNCT:
 			log.Println("Using deprecated FileName header")
-			_, err = dec.ReadString(ctMember, "FileName")
+			a.FileName, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_DIFFERENCES:
-			err = errors.New("Unhandled Differences")
+			var v string
+			if v, err = dec.readUntypedValue(); err == nil {
+				a.setParam("differences", v)
+			}
 		case WSP_PARAMETER_TYPE_PADDING:
-			dec.ReadShortInteger(nil, "")
+			_, err = dec.ReadShortInteger(nil, "")
 		case WSP_PARAMETER_TYPE_CONTENT_TYPE:
-			_, err = dec.ReadString(ctMember, "Type")
+			a.Type, err = dec.readMediaType()
 		case WSP_PARAMETER_TYPE_START_DEFUNCT:
 			log.Println("Using deprecated Start header")
-			_, err = dec.ReadString(ctMember, "Start")
+			a.Start, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_START_INFO_DEFUNCT:
 			log.Println("Using deprecated StartInfo header")
-			_, err = dec.ReadString(ctMember, "StartInfo")
+			a.StartInfo, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_COMMENT_DEFUNCT:
 			log.Println("Using deprecated Comment header")
-			_, err = dec.ReadString(ctMember, "Comment")
+			a.Comment, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_DOMAIN_DEFUNCT:
 			log.Println("Using deprecated Domain header")
-			_, err = dec.ReadString(ctMember, "Domain")
+			a.Domain, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_MAX_AGE:
-			err = errors.New("Unhandled Max Age")
+			var v uint64
+			if v, err = dec.ReadInteger(nil, ""); err == nil {
+				a.setParam("max-age", strconv.FormatUint(v, 10))
+			}
 		case WSP_PARAMETER_TYPE_PATH_DEFUNCT:
 			log.Println("Using deprecated Path header")
-			_, err = dec.ReadString(ctMember, "Path")
+			a.Path, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_SECURE:
-			log.Println("Unhandled Secure header detected")
+			// No-value
+			_, err = dec.ReadByte(nil, "")
+			a.Secure = true
 		case WSP_PARAMETER_TYPE_SEC:
-			v, _ := dec.ReadShortInteger(nil, "")
-			log.Println("Using deprecated and unhandled Sec header with value", v)
+			var v byte
+			if v, err = dec.ReadShortInteger(nil, ""); err == nil {
+				a.setParam("sec", strconv.Itoa(int(v)))
+			}
 		case WSP_PARAMETER_TYPE_MAC:
-			err = errors.New("Unhandled MAC")
+			var v string
+			if v, err = dec.ReadString(nil, ""); err == nil {
+				a.setParam("mac", v)
+			}
 		case WSP_PARAMETER_TYPE_CREATION_DATE:
+			a.CreationDate, err = dec.ReadLongInteger(nil, "")
 		case WSP_PARAMETER_TYPE_MODIFICATION_DATE:
+			a.ModificationDate, err = dec.ReadLongInteger(nil, "")
 		case WSP_PARAMETER_TYPE_READ_DATE:
-			err = errors.New("Unhandled Date parameters")
+			a.ReadDate, err = dec.ReadLongInteger(nil, "")
 		case WSP_PARAMETER_TYPE_SIZE:
-			_, err = dec.ReadInteger(ctMember, "Size")
+			a.Size, err = dec.ReadInteger(nil, "")
 		case WSP_PARAMETER_TYPE_NAME:
-			_, err = dec.ReadString(ctMember, "Name")
+			a.Name, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_FILENAME:
-			_, err = dec.ReadString(ctMember, "FileName")
+			a.FileName, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_START:
-			_, err = dec.ReadString(ctMember, "Start")
+			a.Start, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_START_INFO:
-			_, err = dec.ReadString(ctMember, "StartInfo")
+			a.StartInfo, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_COMMENT:
-			_, err = dec.ReadString(ctMember, "Comment")
+			a.Comment, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_DOMAIN:
-			_, err = dec.ReadString(ctMember, "Domain")
+			a.Domain, err = dec.ReadString(nil, "")
 		case WSP_PARAMETER_TYPE_PATH:
-			_, err = dec.ReadString(ctMember, "Path")
-		case WSP_PARAMETER_TYPE_UNTYPED:
-			v, _ := dec.ReadString(nil, "")
-			log.Println("Unhandled Secure header detected with value", v)
+			a.Path, err = dec.ReadString(nil, "")
 		default:
-			err = fmt.Errorf("Unhandled parameter %#x == %d at offset %d", param, param, dec.Offset)
+			// The value encoding is unknown, so the remaining parameters can't be read.
+			log.Printf("Skipping unhandled content type parameter %#x and the ones following it", param)
+			dec.Offset = endOffset
 		}
 		if err != nil {
 			return err
@@ -293,3 +490,55 @@ func (dec *MMSDecoder) ReadAttachment(ctMember *reflect.Value) error {
 	}
 	return nil
 }
+
+// readUntypedValue reads an Untyped-value as described in section 8.4.2.4 of
+// WAP-230-WSP-20010705-a, Integer-values are returned in decimal form.
+//
+// Untyped-value = Integer-value | Text-value
+func (dec *MMSDecoder) readUntypedValue() (string, error) {
+	if err := dec.ensure(1); err != nil {
+		return "", err
+	}
+	if next := dec.Data[dec.Offset+1]; next&SHORT_FILTER != 0 || (next > 0 && next <= SHORT_LENGTH_MAX) {
+		v, err := dec.ReadInteger(nil, "")
+		return strconv.FormatUint(v, 10), err
+	}
+	return dec.ReadString(nil, "")
+}
+
+// readVersion reads a Version-value as described in section 8.4.2.3 of
+// WAP-230-WSP-20010705-a and returns it in its Short-integer form.
+//
+// Version-value = Short-integer | Text-string
+func (dec *MMSDecoder) readVersion() (byte, error) {
+	if err := dec.ensure(1); err != nil {
+		return 0, err
+	}
+	if dec.Data[dec.Offset+1]&SHORT_FILTER != 0 {
+		return dec.ReadShortInteger(nil, "")
+	}
+	v, err := dec.ReadString(nil, "")
+	if err != nil {
+		return 0, err
+	}
+	// The minor version is 15 if it isn't given.
+	major, minor := 0, 15
+	parts := strings.SplitN(v, ".", 2)
+	if major, err = strconv.Atoi(parts[0]); err != nil || major > 7 {
+		return 0, fmt.Errorf("invalid version %q", v)
+	}
+	if len(parts) > 1 {
+		if minor, err = strconv.Atoi(parts[1]); err != nil || minor > 14 {
+			return 0, fmt.Errorf("invalid version %q", v)
+		}
+	}
+	return byte(major<<4 | minor), nil
+}
+
+// setParam keeps the parameter name with value in Params.
+func (a *Attachment) setParam(name, value string) {
+	if a.Params == nil {
+		a.Params = make(map[string]string)
+	}
+	a.Params[strings.ToLower(name)] = value
+}
@@ -0,0 +1,94 @@
+package mms
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// IsUTF8Compatible returns true if text encoded in charset is valid UTF-8 without transcoding.
+// An empty charset or the "*" (any charset) is considered to be UTF-8.
+func IsUTF8Compatible(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "", "*", "utf-8", "us-ascii":
+		return true
+	}
+	return false
+}
+
+// charsetEncoding returns the encoding for charset named as in CHARSETS.
+func charsetEncoding(charset string) (encoding.Encoding, error) {
+	switch strings.ToLower(charset) {
+	case "iso-10646-ucs-2", "utf-16":
+		// Big endian if no byte order mark is present, RFC 2781 section 4.3.
+		return unicode.UTF16(unicode.BigEndian, unicode.UseBOM), nil
+	case "gb2312":
+		// GBK is a superset of GB2312, which has no decoder of its own.
+		return simplifiedchinese.GBK, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(charset)
+	if err != nil || enc == nil {
+		return nil, ErrorUnsupportedCharset(charset)
+	}
+	return enc, nil
+}
+
+// DecodeCharset transcodes data encoded in charset (as named in CHARSETS) to UTF-8.
+// If the charset is not supported or the data can't be transcoded, data is
+// interpreted as UTF-8 with invalid sequences replaced by U+FFFD and an
+// ErrorUnsupportedCharset or transcoding error is returned along with it.
+func DecodeCharset(data []byte, charset string) (string, error) {
+	if IsUTF8Compatible(charset) {
+		return toValidUTF8(data), nil
+	}
+
+	enc, err := charsetEncoding(charset)
+	if err != nil {
+		return toValidUTF8(data), err
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return toValidUTF8(data), err
+	}
+	return string(decoded), nil
+}
+
+// isWideCharset returns true for charsets with 16 bit code units.
+func isWideCharset(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "iso-10646-ucs-2", "utf-16", "utf-16be", "utf-16le":
+		return true
+	}
+	return false
+}
+
+// trimTextTerminator strips the leading quote and the terminating NUL of a
+// Text-string as defined in WAP-230-WSP section 8.4.2.1. For charsets with 16 bit
+// code units, the terminator is 2 octets long.
+func trimTextTerminator(data []byte, charset string) []byte {
+	if len(data) > 0 && data[0] == TEXT_QUOTE {
+		data = data[1:]
+	}
+	if isWideCharset(charset) {
+		for len(data) >= 2 && data[len(data)-1] == 0 && data[len(data)-2] == 0 {
+			data = data[:len(data)-2]
+		}
+		if len(data)%2 == 1 && data[len(data)-1] == 0 {
+			data = data[:len(data)-1]
+		}
+		return data
+	}
+	return bytes.TrimRight(data, "\x00")
+}
+
+func toValidUTF8(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
@@ -0,0 +1,586 @@
+package mms
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// pduDecoder is implemented by the PDUs that decode themselves without
+// reflection, see MMSDecoder.Decode.
+type pduDecoder interface {
+	decode(dec *MMSDecoder) error
+}
+
+// pduEncoder is implemented by the PDUs that encode themselves without
+// reflection, see MMSEncoder.Encode.
+type pduEncoder interface {
+	encode(enc *MMSEncoder) error
+}
+
+var errUnexpectedContent = errors.New("unexpected content for a PDU without body")
+
+// decodeHeaders calls decodeHeader for every well known header until the data
+// is consumed or decodeHeader is done. Application headers are skipped.
+func (dec *MMSDecoder) decodeHeaders(decodeHeader func(param byte) (done bool, err error)) error {
+	for ; dec.Offset < len(dec.Data); dec.Offset++ {
+		hdrOffset := dec.Offset
+		param, needsDecoding, err := dec.getParam()
+		if err != nil {
+			return err
+		} else if !needsDecoding {
+			continue
+		}
+		done, err := decodeHeader(param)
+		if err != nil {
+			return ErrorDecodeHeader{param, hdrOffset, err}
+		}
+		if done {
+			return nil
+		}
+	}
+	return nil
+}
+
+// skipHeader skips the value of a header the PDU being decoded has no field for.
+func (dec *MMSDecoder) skipHeader(param byte) error {
+	if param == CONTENT_TYPE {
+		return errUnexpectedContent
+	}
+	dec.log = dec.log + fmt.Sprintf("Skipping header %#x\n", param)
+	return dec.skipFieldValue()
+}
+
+// readMessageType reads the message type and checks that it is the expected one.
+// Unknown message types will be discarded. OMA-WAP-MMS-ENC-v1.1 section 7.2.16
+func (dec *MMSDecoder) readMessageType(expected byte) error {
+	parsedType, err := dec.ReadByte(nil, "")
+	if err != nil {
+		return err
+	}
+	if parsedType != expected {
+		return fmt.Errorf("Expected message type %x got %x", expected, parsedType)
+	}
+	return nil
+}
+
+// readBody reads the content type into content and the body following it,
+// either as the parts of a multipart or as data for text/plain.
+func (dec *MMSDecoder) readBody(content *Attachment, parts *[]Attachment, data *[]byte) (err error) {
+	if err := dec.readContentType(content); err != nil {
+		return err
+	}
+	//application/vnd.wap.multipart.related and others
+	if content.MediaType != "text/plain" {
+		*parts, err = dec.readParts()
+		return err
+	}
+	dec.Offset++
+	*data, err = dec.ReadBoundedBytes(nil, "", len(dec.Data))
+	return err
+}
+
+// UnmarshalBinary decodes the m-send.req in data.
+func (pdu *MSendReq) UnmarshalBinary(data []byte) error {
+	return pdu.decode(NewDecoder(data))
+}
+
+func (pdu *MSendReq) decode(dec *MMSDecoder) error {
+	return dec.decodeHeaders(func(param byte) (done bool, err error) {
+		switch param {
+		case X_MMS_MESSAGE_TYPE:
+			err = dec.readMessageType(pdu.Type)
+		case X_MMS_TRANSACTION_ID:
+			pdu.TransactionId, err = dec.ReadString(nil, "")
+		case X_MMS_MMS_VERSION:
+			pdu.Version, err = dec.ReadByte(nil, "")
+		case DATE:
+			pdu.Date, err = dec.ReadLongInteger(nil, "")
+		case FROM:
+			pdu.From, err = dec.readFrom()
+		case TO:
+			var to string
+			if to, err = dec.ReadEncodedString(nil, ""); err == nil {
+				pdu.To = append(pdu.To, to)
+			}
+		case CC:
+			var cc string
+			if cc, err = dec.ReadEncodedString(nil, ""); err == nil {
+				pdu.Cc = append(pdu.Cc, cc)
+			}
+		case BCC:
+			var bcc string
+			if bcc, err = dec.ReadEncodedString(nil, ""); err == nil {
+				pdu.Bcc = append(pdu.Bcc, bcc)
+			}
+		case SUBJECT:
+			pdu.Subject, err = dec.ReadEncodedString(nil, "")
+		case X_MMS_MESSAGE_CLASS:
+			pdu.Class, err = dec.ReadByte(nil, "")
+		case X_MMS_EXPIRY:
+			pdu.Expiry, err = dec.readTimeValue()
+		case X_MMS_DELIVERY_TIME:
+			pdu.DeliveryTime, err = dec.readTimeValue()
+		case X_MMS_PRIORITY:
+			pdu.Priority, err = dec.ReadByte(nil, "")
+		case X_MMS_SENDER_VISIBILITY:
+			pdu.SenderVisibility, err = dec.ReadByte(nil, "")
+		case X_MMS_DELIVERY_REPORT:
+			pdu.DeliveryReport, err = dec.ReadByte(nil, "")
+		case X_MMS_READ_REPORT:
+			pdu.ReadReport, err = dec.ReadByte(nil, "")
+		case CONTENT_TYPE:
+			var content Attachment
+			var parts []Attachment
+			if err = dec.readBody(&content, &parts, new([]byte)); err != nil {
+				return true, err
+			}
+			pdu.ContentType = content.MediaType
+			pdu.ContentTypeStart = content.Start
+			pdu.ContentTypeType = content.Type
+			pdu.Attachments = make([]*Attachment, len(parts))
+			for i := range parts {
+				pdu.Attachments[i] = &parts[i]
+			}
+			return true, nil
+		default:
+			err = dec.skipHeader(param)
+		}
+		return false, err
+	})
+}
+
+// MarshalBinary encodes the m-send.req as defined in OMA-WAP-MMS-ENC-v1.1 section 6.1.1.
+func (pdu *MSendReq) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	err := pdu.encode(NewEncoder(&b))
+	return b.Bytes(), err
+}
+
+func (pdu *MSendReq) encode(enc *MMSEncoder) error {
+	if err := enc.writeByteParam(X_MMS_MESSAGE_TYPE, pdu.Type); err != nil {
+		return err
+	}
+	if err := enc.writeStringParam(X_MMS_TRANSACTION_ID, pdu.TransactionId); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_MMS_VERSION, pdu.Version); err != nil {
+		return err
+	}
+	if pdu.Date > 0 {
+		if err := enc.writeLongIntegerParam(DATE, pdu.Date); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeFrom(); err != nil {
+		return err
+	}
+	for i := range pdu.To {
+		if err := enc.writeStringParam(TO, pdu.To[i]); err != nil {
+			return err
+		}
+	}
+	for i := range pdu.Cc {
+		if err := enc.writeStringParam(CC, pdu.Cc[i]); err != nil {
+			return err
+		}
+	}
+	for i := range pdu.Bcc {
+		if err := enc.writeStringParam(BCC, pdu.Bcc[i]); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeEncodedStringParam(SUBJECT, pdu.Subject); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_MESSAGE_CLASS, pdu.Class); err != nil {
+		return err
+	}
+	if !pdu.Expiry.IsZero() {
+		if err := enc.writeTimeValueParam(X_MMS_EXPIRY, pdu.Expiry); err != nil {
+			return err
+		}
+	}
+	if !pdu.DeliveryTime.IsZero() {
+		if err := enc.writeTimeValueParam(X_MMS_DELIVERY_TIME, pdu.DeliveryTime); err != nil {
+			return err
+		}
+	}
+	if pdu.Priority != 0 {
+		if err := enc.writeByteParam(X_MMS_PRIORITY, pdu.Priority); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeByteParam(X_MMS_DELIVERY_REPORT, pdu.DeliveryReport); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_READ_REPORT, pdu.ReadReport); err != nil {
+		return err
+	}
+	// if there is a ContentType there has to be content
+	if err := enc.setParam(CONTENT_TYPE); err != nil {
+		return err
+	}
+	if err := enc.writeContentType(pdu.ContentType, pdu.ContentTypeStart, pdu.ContentTypeType, "", ""); err != nil {
+		return err
+	}
+	return enc.writeAttachments(pdu.Attachments)
+}
+
+// UnmarshalBinary decodes the m-send.conf in data.
+func (pdu *MSendConf) UnmarshalBinary(data []byte) error {
+	return pdu.decode(NewDecoder(data))
+}
+
+func (pdu *MSendConf) decode(dec *MMSDecoder) error {
+	return dec.decodeHeaders(func(param byte) (done bool, err error) {
+		switch param {
+		case X_MMS_MESSAGE_TYPE:
+			err = dec.readMessageType(pdu.Type)
+		case X_MMS_TRANSACTION_ID:
+			pdu.TransactionId, err = dec.ReadString(nil, "")
+		case X_MMS_MMS_VERSION:
+			pdu.Version, err = dec.ReadByte(nil, "")
+		case X_MMS_RESPONSE_STATUS:
+			pdu.ResponseStatus, err = dec.ReadByte(nil, "")
+		case X_MMS_RESPONSE_TEXT:
+			pdu.ResponseText, err = dec.ReadString(nil, "")
+		case MESSAGE_ID:
+			pdu.MessageId, err = dec.ReadString(nil, "")
+		default:
+			err = dec.skipHeader(param)
+		}
+		return false, err
+	})
+}
+
+// MarshalBinary encodes the m-send.conf as defined in OMA-WAP-MMS-ENC-v1.1 section 6.1.2.
+func (pdu *MSendConf) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	err := pdu.encode(NewEncoder(&b))
+	return b.Bytes(), err
+}
+
+func (pdu *MSendConf) encode(enc *MMSEncoder) error {
+	if err := enc.writeByteParam(X_MMS_MESSAGE_TYPE, pdu.Type); err != nil {
+		return err
+	}
+	if err := enc.writeStringParam(X_MMS_TRANSACTION_ID, pdu.TransactionId); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_MMS_VERSION, pdu.Version); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_RESPONSE_STATUS, pdu.ResponseStatus); err != nil {
+		return err
+	}
+	if err := enc.writeStringParam(X_MMS_RESPONSE_TEXT, pdu.ResponseText); err != nil {
+		return err
+	}
+	return enc.writeStringParam(MESSAGE_ID, pdu.MessageId)
+}
+
+// UnmarshalBinary decodes the m-notification.ind in data, relative expiries
+// are resolved against the Received time.
+func (pdu *MNotificationInd) UnmarshalBinary(data []byte) error {
+	return pdu.decode(NewDecoder(data))
+}
+
+func (pdu *MNotificationInd) decode(dec *MMSDecoder) error {
+	return dec.decodeHeaders(func(param byte) (done bool, err error) {
+		switch param {
+		case X_MMS_MESSAGE_TYPE:
+			err = dec.readMessageType(pdu.Type)
+		case X_MMS_TRANSACTION_ID:
+			pdu.TransactionId, err = dec.ReadString(nil, "")
+		case X_MMS_MMS_VERSION:
+			pdu.Version, err = dec.ReadByte(nil, "")
+		case FROM:
+			var from string
+			if from, err = dec.readFrom(); err == nil && from != "" {
+				pdu.From = from
+			}
+		case SUBJECT:
+			pdu.Subject, err = dec.ReadEncodedString(nil, "")
+		case X_MMS_DELIVERY_REPORT:
+			pdu.DeliveryReport, err = dec.ReadByte(nil, "")
+		case X_MMS_MESSAGE_CLASS:
+			//TODO implement Token text form
+			pdu.Class, err = dec.ReadByte(nil, "")
+		case X_MMS_PRIORITY:
+			pdu.Priority, err = dec.ReadByte(nil, "")
+		case X_MMS_MESSAGE_SIZE:
+			pdu.Size, err = dec.ReadLongInteger(nil, "")
+		case X_MMS_EXPIRY:
+			pdu.Expiry, err = dec.ReadExpiry(nil, pdu.Received)
+		case X_MMS_REPLY_CHARGING:
+			pdu.ReplyCharging, err = dec.ReadByte(nil, "")
+		case X_MMS_REPLY_CHARGING_DEADLINE:
+			pdu.ReplyChargingDeadline, err = dec.readTimeValue()
+		case X_MMS_REPLY_CHARGING_ID:
+			pdu.ReplyChargingId, err = dec.ReadString(nil, "")
+		case X_MMS_CONTENT_LOCATION:
+			pdu.ContentLocation, err = dec.ReadString(nil, "")
+			return true, err
+		default:
+			err = dec.skipHeader(param)
+		}
+		return false, err
+	})
+}
+
+// MarshalBinary encodes the m-notification.ind as defined in OMA-WAP-MMS-ENC-v1.1 section 6.2.
+func (pdu *MNotificationInd) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	err := pdu.encode(NewEncoder(&b))
+	return b.Bytes(), err
+}
+
+func (pdu *MNotificationInd) encode(enc *MMSEncoder) error {
+	if err := enc.writeByteParam(X_MMS_MESSAGE_TYPE, pdu.Type); err != nil {
+		return err
+	}
+	if err := enc.writeStringParam(X_MMS_TRANSACTION_ID, pdu.TransactionId); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_MMS_VERSION, pdu.Version); err != nil {
+		return err
+	}
+	if pdu.From != "" {
+		if err := enc.writeFromAddress(pdu.From); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeEncodedStringParam(SUBJECT, pdu.Subject); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_MESSAGE_CLASS, pdu.Class); err != nil {
+		return err
+	}
+	if err := enc.writeLongIntegerParam(X_MMS_MESSAGE_SIZE, pdu.Size); err != nil {
+		return err
+	}
+	if !pdu.Expiry.IsZero() {
+		if err := enc.writeTimeValueParam(X_MMS_EXPIRY, AbsoluteTime(pdu.Expiry)); err != nil {
+			return err
+		}
+	}
+	if pdu.DeliveryReport != 0 {
+		if err := enc.writeByteParam(X_MMS_DELIVERY_REPORT, pdu.DeliveryReport); err != nil {
+			return err
+		}
+	}
+	if pdu.Priority != 0 {
+		if err := enc.writeByteParam(X_MMS_PRIORITY, pdu.Priority); err != nil {
+			return err
+		}
+	}
+	// The decoder stops at the content location, keep it last.
+	return enc.writeStringParam(X_MMS_CONTENT_LOCATION, pdu.ContentLocation)
+}
+
+// UnmarshalBinary decodes the m-notifyresp.ind in data.
+func (pdu *MNotifyRespInd) UnmarshalBinary(data []byte) error {
+	return pdu.decode(NewDecoder(data))
+}
+
+func (pdu *MNotifyRespInd) decode(dec *MMSDecoder) error {
+	return dec.decodeHeaders(func(param byte) (done bool, err error) {
+		switch param {
+		case X_MMS_MESSAGE_TYPE:
+			err = dec.readMessageType(pdu.Type)
+		case X_MMS_TRANSACTION_ID:
+			pdu.TransactionId, err = dec.ReadString(nil, "")
+		case X_MMS_MMS_VERSION:
+			pdu.Version, err = dec.ReadByte(nil, "")
+		case X_MMS_STATUS:
+			pdu.Status, err = dec.ReadByte(nil, "")
+		case X_MMS_REPORT_ALLOWED:
+			pdu.ReportAllowed, err = dec.ReadByte(nil, "")
+		default:
+			err = dec.skipHeader(param)
+		}
+		return false, err
+	})
+}
+
+// MarshalBinary encodes the m-notifyresp.ind as defined in OMA-WAP-MMS-ENC-v1.1 section 6.2.
+func (pdu *MNotifyRespInd) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	err := pdu.encode(NewEncoder(&b))
+	return b.Bytes(), err
+}
+
+func (pdu *MNotifyRespInd) encode(enc *MMSEncoder) error {
+	if err := enc.writeByteParam(X_MMS_MESSAGE_TYPE, pdu.Type); err != nil {
+		return err
+	}
+	if err := enc.writeStringParam(X_MMS_TRANSACTION_ID, pdu.TransactionId); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_MMS_VERSION, pdu.Version); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_STATUS, pdu.Status); err != nil {
+		return err
+	}
+	return enc.writeByteParam(X_MMS_REPORT_ALLOWED, pdu.ReportAllowed)
+}
+
+// UnmarshalBinary decodes the m-retrieve.conf in data.
+func (pdu *MRetrieveConf) UnmarshalBinary(data []byte) error {
+	return pdu.decode(NewDecoder(data))
+}
+
+func (pdu *MRetrieveConf) decode(dec *MMSDecoder) error {
+	return dec.decodeHeaders(func(param byte) (done bool, err error) {
+		switch param {
+		case X_MMS_MESSAGE_TYPE:
+			err = dec.readMessageType(pdu.Type)
+		case X_MMS_TRANSACTION_ID:
+			pdu.TransactionId, err = dec.ReadString(nil, "")
+		case X_MMS_MMS_VERSION:
+			pdu.Version, err = dec.ReadByte(nil, "")
+		case MESSAGE_ID:
+			pdu.MessageId, err = dec.ReadString(nil, "")
+		case FROM:
+			var from string
+			if from, err = dec.readFrom(); err == nil && from != "" {
+				pdu.From = from
+			}
+		case TO:
+			var to string
+			if to, err = dec.ReadEncodedString(nil, ""); err == nil {
+				pdu.To = append(pdu.To, to)
+			}
+		case CC:
+			var cc string
+			if cc, err = dec.ReadEncodedString(nil, ""); err == nil {
+				pdu.Cc = append(pdu.Cc, cc)
+			}
+		case SUBJECT:
+			pdu.Subject, err = dec.ReadEncodedString(nil, "")
+		case DATE:
+			pdu.Date, err = dec.ReadLongInteger(nil, "")
+		case X_MMS_MESSAGE_CLASS:
+			//TODO implement Token text form
+			pdu.Class, err = dec.ReadByte(nil, "")
+		case X_MMS_PRIORITY:
+			pdu.Priority, err = dec.ReadByte(nil, "")
+		case X_MMS_DELIVERY_REPORT:
+			pdu.DeliveryReport, err = dec.ReadByte(nil, "")
+		case X_MMS_READ_REPORT:
+			pdu.ReadReport, err = dec.ReadByte(nil, "")
+		case X_MMS_STATUS:
+			pdu.Status, err = dec.ReadByte(nil, "")
+		case X_MMS_RETRIEVE_STATUS:
+			pdu.RetrieveStatus, err = dec.ReadByte(nil, "")
+		case X_MMS_RETRIEVE_TEXT:
+			pdu.RetrieveText, err = dec.ReadString(nil, "")
+		case X_MMS_REPLY_CHARGING:
+			pdu.ReplyCharging, err = dec.ReadByte(nil, "")
+		case X_MMS_REPLY_CHARGING_DEADLINE:
+			pdu.ReplyChargingDeadline, err = dec.readTimeValue()
+		case X_MMS_REPLY_CHARGING_ID:
+			pdu.ReplyChargingId, err = dec.ReadString(nil, "")
+		case CONTENT_TYPE:
+			return true, dec.readBody(&pdu.Content, &pdu.Attachments, &pdu.Data)
+		default:
+			err = dec.skipHeader(param)
+		}
+		return false, err
+	})
+}
+
+// MarshalBinary encodes the m-retrieve.conf as defined in OMA-WAP-MMS-ENC-v1.1 section 6.3.
+func (pdu *MRetrieveConf) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	err := pdu.encode(NewEncoder(&b))
+	return b.Bytes(), err
+}
+
+func (pdu *MRetrieveConf) encode(enc *MMSEncoder) error {
+	if err := enc.writeByteParam(X_MMS_MESSAGE_TYPE, pdu.Type); err != nil {
+		return err
+	}
+	if err := enc.writeStringParam(X_MMS_TRANSACTION_ID, pdu.TransactionId); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_MMS_VERSION, pdu.Version); err != nil {
+		return err
+	}
+	if err := enc.writeStringParam(MESSAGE_ID, pdu.MessageId); err != nil {
+		return err
+	}
+	if pdu.Date > 0 {
+		if err := enc.writeLongIntegerParam(DATE, pdu.Date); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeFromAddress(pdu.From); err != nil {
+		return err
+	}
+	for i := range pdu.To {
+		if err := enc.writeEncodedStringParam(TO, pdu.To[i]); err != nil {
+			return err
+		}
+	}
+	for i := range pdu.Cc {
+		if err := enc.writeEncodedStringParam(CC, pdu.Cc[i]); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeEncodedStringParam(SUBJECT, pdu.Subject); err != nil {
+		return err
+	}
+	if err := enc.writeByteParam(X_MMS_MESSAGE_CLASS, pdu.Class); err != nil {
+		return err
+	}
+	for _, param := range []struct {
+		param, value byte
+	}{
+		{X_MMS_PRIORITY, pdu.Priority},
+		{X_MMS_DELIVERY_REPORT, pdu.DeliveryReport},
+		{X_MMS_READ_REPORT, pdu.ReadReport},
+		{X_MMS_RETRIEVE_STATUS, pdu.RetrieveStatus},
+	} {
+		if param.value == 0 {
+			continue
+		}
+		if err := enc.writeByteParam(param.param, param.value); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeStringParam(X_MMS_RETRIEVE_TEXT, pdu.RetrieveText); err != nil {
+		return err
+	}
+
+	if err := enc.setParam(CONTENT_TYPE); err != nil {
+		return err
+	}
+	if err := enc.writeContentType(pdu.Content.MediaType, pdu.Content.Start, pdu.Content.Type, "", pdu.Content.Charset); err != nil {
+		return err
+	}
+	if pdu.Content.MediaType == "text/plain" {
+		return enc.writeBytes(pdu.Data, len(pdu.Data))
+	}
+	parts := make([]*Attachment, len(pdu.Attachments))
+	for i := range pdu.Attachments {
+		part := pdu.Attachments[i]
+		// The decoder appends the charset to the media type.
+		part.MediaType = strings.TrimSuffix(part.MediaType, ";charset="+part.Charset)
+		parts[i] = &part
+	}
+	return enc.writeAttachments(parts)
+}
+
+func (a *Attachment) encode(enc *MMSEncoder) error {
+	if err := enc.writeContentType(a.MediaType, "", "", a.Name, a.Charset); err != nil {
+		return err
+	}
+	if err := enc.writeStringParam(MMS_PART_CONTENT_LOCATION, a.ContentLocation); err != nil {
+		return err
+	}
+	return enc.writeQuotedStringParam(MMS_PART_CONTENT_ID, a.ContentId)
+}
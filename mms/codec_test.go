@@ -0,0 +1,360 @@
+package mms
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "launchpad.net/gocheck"
+)
+
+type CodecTestSuite struct{}
+
+var _ = Suite(&CodecTestSuite{})
+
+func newTestMSendReq() *MSendReq {
+	smil := &Attachment{
+		MediaType:       "application/smil",
+		Name:            "smil.xml",
+		ContentId:       "<smil>",
+		ContentLocation: "smil.xml",
+		Data:            []byte("<smil></smil>"),
+	}
+	text := &Attachment{
+		MediaType:       "text/plain",
+		Name:            "text0.txt",
+		Charset:         "utf-8",
+		ContentId:       "<text0>",
+		ContentLocation: "text0.txt",
+		Data:            []byte("Γειά σου"),
+	}
+	return &MSendReq{
+		Type:             TYPE_SEND_REQ,
+		TransactionId:    "1234567890",
+		Version:          MMS_MESSAGE_VERSION_1_1,
+		Date:             1420070400,
+		To:               []string{"+12345/TYPE=PLMN", "+67890/TYPE=PLMN"},
+		Cc:               []string{"+11111/TYPE=PLMN", "+22222/TYPE=PLMN"},
+		Bcc:              []string{"+33333/TYPE=PLMN"},
+		Subject:          "Тема",
+		Class:            ClassPersonal,
+		Expiry:           RelativeTime(7 * 24 * time.Hour),
+		DeliveryTime:     AbsoluteTime(time.Unix(1420074000, 0)),
+		Priority:         PriorityHigh,
+		DeliveryReport:   DeliveryReportYes,
+		ReadReport:       ReadReportNo,
+		ContentType:      "application/vnd.wap.multipart.related",
+		ContentTypeStart: "<smil>",
+		ContentTypeType:  "application/smil",
+		Attachments:      []*Attachment{smil, text},
+	}
+}
+
+func (s *CodecTestSuite) TestMSendReqRoundTrip(c *C) {
+	mSendReq := newTestMSendReq()
+	b, err := mSendReq.MarshalBinary()
+	c.Assert(err, IsNil)
+
+	decoded := &MSendReq{Type: TYPE_SEND_REQ}
+	c.Assert(decoded.UnmarshalBinary(b), IsNil)
+	c.Check(decoded.TransactionId, Equals, mSendReq.TransactionId)
+	c.Check(decoded.Version, Equals, mSendReq.Version)
+	c.Check(decoded.Date, Equals, mSendReq.Date)
+	c.Check(decoded.To, DeepEquals, mSendReq.To)
+	c.Check(decoded.Cc, DeepEquals, mSendReq.Cc)
+	c.Check(decoded.Bcc, DeepEquals, mSendReq.Bcc)
+	c.Check(decoded.Subject, Equals, mSendReq.Subject)
+	c.Check(decoded.Class, Equals, mSendReq.Class)
+	c.Check(decoded.Expiry, Equals, mSendReq.Expiry)
+	c.Check(decoded.DeliveryTime, Equals, mSendReq.DeliveryTime)
+	c.Check(decoded.Priority, Equals, mSendReq.Priority)
+	c.Check(decoded.DeliveryReport, Equals, mSendReq.DeliveryReport)
+	c.Check(decoded.ReadReport, Equals, mSendReq.ReadReport)
+	c.Check(decoded.ContentType, Equals, mSendReq.ContentType)
+	c.Check(decoded.ContentTypeStart, Equals, mSendReq.ContentTypeStart)
+	c.Check(decoded.ContentTypeType, Equals, mSendReq.ContentTypeType)
+	c.Assert(decoded.Attachments, HasLen, len(mSendReq.Attachments))
+	for i, a := range mSendReq.Attachments {
+		c.Check(decoded.Attachments[i].Name, Equals, a.Name)
+		c.Check(decoded.Attachments[i].Charset, Equals, a.Charset)
+		c.Check(decoded.Attachments[i].ContentId, Equals, a.ContentId)
+		c.Check(decoded.Attachments[i].ContentLocation, Equals, a.ContentLocation)
+		c.Check(decoded.Attachments[i].Data, DeepEquals, a.Data)
+	}
+}
+
+func (s *CodecTestSuite) TestMSendConfRoundTrip(c *C) {
+	mSendConf := &MSendConf{
+		Type:           TYPE_SEND_CONF,
+		TransactionId:  "1234567890",
+		Version:        MMS_MESSAGE_VERSION_1_1,
+		ResponseStatus: ResponseStatusOk,
+		ResponseText:   "Ok",
+		MessageId:      "abcdef",
+	}
+	b, err := mSendConf.MarshalBinary()
+	c.Assert(err, IsNil)
+
+	decoded := NewMSendConf()
+	c.Assert(decoded.UnmarshalBinary(b), IsNil)
+	c.Check(decoded, DeepEquals, mSendConf)
+}
+
+func (s *CodecTestSuite) TestMNotificationIndRoundTrip(c *C) {
+	received := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+	mNotificationInd := &MNotificationInd{
+		Type:            TYPE_NOTIFICATION_IND,
+		TransactionId:   "1234567890",
+		Version:         MMS_MESSAGE_VERSION_1_0,
+		From:            "+12345/TYPE=PLMN",
+		Subject:         "Тема",
+		Class:           ClassPersonal,
+		Size:            29696,
+		Expiry:          received.Add(48 * time.Hour).Local(),
+		ContentLocation: "http://localhost:9191/mms",
+	}
+	b, err := mNotificationInd.MarshalBinary()
+	c.Assert(err, IsNil)
+
+	decoded := &MNotificationInd{Type: TYPE_NOTIFICATION_IND}
+	c.Assert(decoded.UnmarshalBinary(b), IsNil)
+	c.Check(decoded, DeepEquals, mNotificationInd)
+}
+
+func (s *CodecTestSuite) TestMNotifyRespIndRoundTrip(c *C) {
+	mNotifyRespInd := &MNotifyRespInd{
+		Type:          TYPE_NOTIFYRESP_IND,
+		TransactionId: "1234567890",
+		Version:       MMS_MESSAGE_VERSION_1_1,
+		Status:        STATUS_DEFERRED,
+		ReportAllowed: ReportAllowedYes,
+	}
+	b, err := mNotifyRespInd.MarshalBinary()
+	c.Assert(err, IsNil)
+
+	decoded := NewMNotifyRespInd()
+	c.Assert(decoded.UnmarshalBinary(b), IsNil)
+	c.Check(decoded, DeepEquals, mNotifyRespInd)
+}
+
+func (s *CodecTestSuite) TestMRetrieveConfRoundTrip(c *C) {
+	mSendReq := newTestMSendReq()
+	mRetrieveConf := &MRetrieveConf{
+		Type:          TYPE_RETRIEVE_CONF,
+		TransactionId: mSendReq.TransactionId,
+		Version:       mSendReq.Version,
+		MessageId:     "abcdef",
+		From:          "+12345/TYPE=PLMN",
+		To:            mSendReq.To,
+		Cc:            mSendReq.Cc,
+		Subject:       mSendReq.Subject,
+		Date:          mSendReq.Date,
+		Content: Attachment{
+			MediaType: mSendReq.ContentType,
+			Start:     mSendReq.ContentTypeStart,
+			Type:      mSendReq.ContentTypeType,
+		},
+	}
+	for _, a := range mSendReq.Attachments {
+		mRetrieveConf.Attachments = append(mRetrieveConf.Attachments, *a)
+	}
+
+	b, err := mRetrieveConf.MarshalBinary()
+	c.Assert(err, IsNil)
+
+	decoded := NewMRetrieveConf("")
+	c.Assert(decoded.UnmarshalBinary(b), IsNil)
+	reflected := NewMRetrieveConf("")
+	c.Assert(NewDecoder(b).decodeFields(reflected), IsNil)
+	c.Check(reflected.Cc, DeepEquals, mRetrieveConf.Cc)
+
+	c.Check(decoded.MessageId, Equals, mRetrieveConf.MessageId)
+	c.Check(decoded.From, Equals, mRetrieveConf.From)
+	c.Check(decoded.To, DeepEquals, mRetrieveConf.To)
+	c.Check(decoded.Cc, DeepEquals, mRetrieveConf.Cc)
+	c.Check(decoded.Subject, Equals, mRetrieveConf.Subject)
+	c.Check(decoded.Date, Equals, mRetrieveConf.Date)
+	c.Check(decoded.Content.MediaType, Equals, mRetrieveConf.Content.MediaType)
+	c.Check(decoded.Content.Start, Equals, mRetrieveConf.Content.Start)
+	c.Check(decoded.Content.Type, Equals, mRetrieveConf.Content.Type)
+	c.Assert(decoded.Attachments, HasLen, len(mRetrieveConf.Attachments))
+	for i, a := range mRetrieveConf.Attachments {
+		// The decoder appends the charset to the media type.
+		c.Check(strings.Split(decoded.Attachments[i].MediaType, ";")[0], Equals, a.MediaType)
+		c.Check(decoded.Attachments[i].Name, Equals, a.Name)
+		c.Check(decoded.Attachments[i].Charset, Equals, a.Charset)
+		c.Check(decoded.Attachments[i].ContentId, Equals, a.ContentId)
+		c.Check(decoded.Attachments[i].ContentLocation, Equals, a.ContentLocation)
+		c.Check(decoded.Attachments[i].Data, DeepEquals, a.Data)
+	}
+}
+
+func (s *CodecTestSuite) TestDecodeReplyChargingDeadline(c *C) {
+	inputBytes := []byte{
+		// Message Type m-notification.ind
+		0x8C, 0x82,
+		// Transaction Id "t"
+		0x98, 0x74, 0x00,
+		// MMS Version 1.0
+		0x8D, 0x90,
+		// Reply Charging requested
+		0x9C, 0x80,
+		// Reply Charging Deadline in 60 seconds
+		0x9D, 0x03, 0x81, 0x01, 0x3C,
+		// Reply Charging Id "r"
+		0x9E, 0x72, 0x00,
+		// Content Location "http://x"
+		0x83, 0x68, 0x74, 0x74, 0x70, 0x3A, 0x2F, 0x2F, 0x78, 0x00,
+	}
+	decoded := &MNotificationInd{Type: TYPE_NOTIFICATION_IND}
+	c.Assert(NewDecoder(inputBytes).Decode(decoded), IsNil)
+	reflected := &MNotificationInd{Type: TYPE_NOTIFICATION_IND}
+	c.Assert(NewDecoder(inputBytes).decodeFields(reflected), IsNil)
+	for _, pdu := range []*MNotificationInd{decoded, reflected} {
+		c.Check(pdu.ReplyCharging, Equals, byte(0x80))
+		c.Check(pdu.ReplyChargingDeadline, Equals, RelativeTime(time.Minute))
+		c.Check(pdu.ReplyChargingId, Equals, "r")
+		c.Check(pdu.ContentLocation, Equals, "http://x")
+	}
+}
+
+func (s *CodecTestSuite) TestUnmarshalStoredReplyChargingDeadline(c *C) {
+	// Stored before the deadline was decoded as a TimeValue.
+	var mNotificationInd MNotificationInd
+	c.Assert(json.Unmarshal([]byte(`{"ReplyChargingDeadline":3,"ContentLocation":"http://x"}`), &mNotificationInd), IsNil)
+	c.Check(mNotificationInd.ReplyChargingDeadline, Equals, TimeValue{})
+	c.Check(mNotificationInd.ContentLocation, Equals, "http://x")
+
+	mNotificationInd.ReplyChargingDeadline = RelativeTime(time.Minute)
+	b, err := json.Marshal(&mNotificationInd)
+	c.Assert(err, IsNil)
+	var decoded MNotificationInd
+	c.Assert(json.Unmarshal(b, &decoded), IsNil)
+	c.Check(decoded.ReplyChargingDeadline, Equals, RelativeTime(time.Minute))
+}
+
+func (s *CodecTestSuite) TestDecodeMNotifyRespIndUnexpectedContent(c *C) {
+	inputBytes := []byte{
+		0x8c, TYPE_NOTIFYRESP_IND,
+		0x84, 0x83,
+	}
+	err := NewDecoder(inputBytes).Decode(NewMNotifyRespInd())
+	c.Check(err, DeepEquals, ErrorDecodeHeader{CONTENT_TYPE, 2, errUnexpectedContent})
+}
+
+func TestTypedDecodeMatchesReflection(t *testing.T) {
+	testCases := []struct {
+		file   string
+		newPdu func() MMSReader
+	}{
+		{"test_payloads/m-send.conf_success", func() MMSReader { return NewMSendConf() }},
+		{"test_payloads/m-retrieve.conf_success", func() MMSReader { return NewMRetrieveConf("55555555") }},
+		{"test_payloads/m-notification.ind_success", func() MMSReader { return &MNotificationInd{} }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.file)
+			if err != nil {
+				t.Fatalf("Can't load test data from %s due to error: %v", tc.file, err)
+			}
+
+			want := tc.newPdu()
+			wantErr := NewDecoder(data).decodeFields(want)
+			got := tc.newPdu()
+			gotErr := NewDecoder(data).Decode(got)
+
+			if !reflect.DeepEqual(gotErr, wantErr) {
+				t.Errorf("Decode error = %v, want %v", gotErr, wantErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Decode = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestTypedEncodeMatchesReflection(t *testing.T) {
+	testCases := []struct {
+		name string
+		pdu  MMSWriter
+	}{
+		{"m-send.req", newTestMSendReq()},
+		{"m-notifyresp.ind", &MNotifyRespInd{
+			Type:          TYPE_NOTIFYRESP_IND,
+			TransactionId: "1234567890",
+			Version:       MMS_MESSAGE_VERSION_1_1,
+			Status:        STATUS_RETRIEVED,
+			ReportAllowed: ReportAllowedNo,
+		}},
+		{"attachment", newTestMSendReq().Attachments[1]},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var want, got bytes.Buffer
+			if err := NewEncoder(&want).encodeFields(tc.pdu); err != nil {
+				t.Fatalf("encodeFields error = %v", err)
+			}
+			if err := NewEncoder(&got).Encode(tc.pdu); err != nil {
+				t.Fatalf("Encode error = %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("Encode = %#v, want %#v", got.Bytes(), want.Bytes())
+			}
+		})
+	}
+}
+
+func benchmarkDecodeMRetrieveConf(b *testing.B, decode func(dec *MMSDecoder, pdu *MRetrieveConf) error) {
+	data, err := ioutil.ReadFile("test_payloads/m-retrieve.conf_success")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := decode(NewDecoder(data), NewMRetrieveConf("")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeMRetrieveConf(b *testing.B) {
+	benchmarkDecodeMRetrieveConf(b, func(dec *MMSDecoder, pdu *MRetrieveConf) error {
+		return dec.Decode(pdu)
+	})
+}
+
+func BenchmarkDecodeMRetrieveConfReflection(b *testing.B) {
+	benchmarkDecodeMRetrieveConf(b, func(dec *MMSDecoder, pdu *MRetrieveConf) error {
+		return dec.decodeFields(pdu)
+	})
+}
+
+func benchmarkEncodeMSendReq(b *testing.B, encode func(enc *MMSEncoder, pdu *MSendReq) error) {
+	mSendReq := newTestMSendReq()
+	var out bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		if err := encode(NewEncoder(&out), mSendReq); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeMSendReq(b *testing.B) {
+	benchmarkEncodeMSendReq(b, func(enc *MMSEncoder, pdu *MSendReq) error {
+		return enc.Encode(pdu)
+	})
+}
+
+func BenchmarkEncodeMSendReqReflection(b *testing.B) {
+	benchmarkEncodeMSendReq(b, func(enc *MMSEncoder, pdu *MSendReq) error {
+		return enc.encodeFields(pdu)
+	})
+}
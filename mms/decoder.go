@@ -38,67 +38,164 @@ type MMSDecoder struct {
 	log    string
 }
 
+// GetMessageType returns the X-Mms-Message-Type of the encoded PDU in data
+// without decoding it, which is useful to select the structure to decode into.
+//
+// OMA-WAP-MMS-ENC-v1.1 section 7.1 mandates the message type to be the first
+// header of every PDU.
+func GetMessageType(data []byte) (byte, error) {
+	if len(data) < 2 {
+		return 0, ErrorDecodeShortData{len(data), 2}
+	}
+	if data[0] != X_MMS_MESSAGE_TYPE|SHORT_FILTER {
+		return 0, fmt.Errorf("expected message type header %#x but got %#x", X_MMS_MESSAGE_TYPE|SHORT_FILTER, data[0])
+	}
+	return data[1], nil
+}
+
+// ensure returns an ErrorDecodeShortData if there are less than n octets left
+// to be read after the current offset.
+func (dec *MMSDecoder) ensure(n int) error {
+	if n < 0 || dec.Offset < -1 || dec.Offset+n >= len(dec.Data) {
+		return ErrorDecodeShortData{len(dec.Data), dec.Offset + n}
+	}
+	return nil
+}
+
+// endOffset returns the offset of the last octet of a value of length octets
+// starting after the current offset, or an ErrorDecodeShortData if the value
+// doesn't fit in the data.
+func (dec *MMSDecoder) endOffset(length uint64) (int, error) {
+	if length > uint64(len(dec.Data)) {
+		// Any offset beyond the data will do and this one can't overflow.
+		return 0, ErrorDecodeShortData{len(dec.Data), dec.Offset + len(dec.Data) + 1}
+	}
+	end := dec.Offset + int(length)
+	if end >= len(dec.Data) {
+		return 0, ErrorDecodeShortData{len(dec.Data), end}
+	}
+	return end, nil
+}
+
 func (dec *MMSDecoder) setPduField(pdu *reflect.Value, name string, v interface{},
 	setter func(*reflect.Value, interface{})) {
 
 	if name != "" {
 		field := pdu.FieldByName(name)
-		if field.IsValid() {
+		if !field.IsValid() {
+			log.Println("Field", name, "not in decoding structure")
+		} else if !canHold(field, v) {
+			log.Printf("Field %s in decoding structure cannot hold a %T", name, v)
+		} else {
 			setter(&field, v)
 			dec.log = dec.log + fmt.Sprintf("Setting %s to %v\n", name, v)
-		} else {
-			log.Println("Field", name, "not in decoding structure")
 		}
 	}
 }
 
-func setterString(field *reflect.Value, v interface{}) { field.SetString(v.(string)) }
-func setterUint64(field *reflect.Value, v interface{}) { field.SetUint(v.(uint64)) }
-func setterSlice(field *reflect.Value, v interface{})  { field.SetBytes(v.([]byte)) }
-func setterTime(field *reflect.Value, v interface{})   { field.Set(reflect.ValueOf(v)) }
+// canHold returns true if v can be set on field by its setter, decoded data
+// may not match the field it is decoded into.
+func canHold(field reflect.Value, v interface{}) bool {
+	switch v.(type) {
+	case uint64:
+		return field.Kind() >= reflect.Uint && field.Kind() <= reflect.Uint64
+	case float64:
+		return field.Kind() == reflect.Float32 || field.Kind() == reflect.Float64
+	}
+	return reflect.TypeOf(v).AssignableTo(field.Type())
+}
+
+func setterString(field *reflect.Value, v interface{})  { field.SetString(v.(string)) }
+func setterUint64(field *reflect.Value, v interface{})  { field.SetUint(v.(uint64)) }
+func setterSlice(field *reflect.Value, v interface{})   { field.SetBytes(v.([]byte)) }
+func setterTime(field *reflect.Value, v interface{})    { field.Set(reflect.ValueOf(v)) }
+func setterFloat64(field *reflect.Value, v interface{}) { field.SetFloat(v.(float64)) }
 
+// ReadEncodedString reads an Encoded-string-value as defined in OMA-WAP-MMS section 7.2.9
+// and returns it transcoded to UTF-8 according to its charset.
+//
+// Encoded-string-value = Text-string | Value-length Char-set Text-string
+//
+// Unknown or unsupported charsets fall back to UTF-8 and are reported in the decoder log.
 func (dec *MMSDecoder) ReadEncodedString(reflectedPdu *reflect.Value, hdr string) (string, error) {
 	var length uint64
+	if err := dec.ensure(1); err != nil {
+		return "", err
+	}
 	var err error
-	switch {
-	case dec.Data[dec.Offset+1] < SHORT_LENGTH_MAX:
+	switch next := dec.Data[dec.Offset+1]; {
+	case next == 0:
+		// Empty Text-string.
+		dec.Offset++
+		dec.setPduField(reflectedPdu, hdr, "", setterString)
+		return "", nil
+	case next <= SHORT_LENGTH_MAX:
 		var l byte
 		l, err = dec.ReadShortInteger(nil, "")
 		length = uint64(l)
-	case dec.Data[dec.Offset+1] == LENGTH_QUOTE:
+	case next == LENGTH_QUOTE:
 		dec.Offset++
 		length, err = dec.ReadUintVar(nil, "")
 	}
 	if err != nil {
 		return "", err
 	}
-	if length != 0 {
-		charset, err := dec.ReadCharset(nil, "")
+	if length == 0 {
+		// No charset, the Text-string is us-ascii or utf-8.
+		str, err := dec.ReadString(nil, "")
 		if err != nil {
 			return "", err
 		}
-		dec.log = dec.log + fmt.Sprintf("Next string encoded with: %s\n", charset)
+		v := toValidUTF8([]byte(str))
+		dec.setPduField(reflectedPdu, hdr, v, setterString)
+		return v, nil
 	}
-	var str string
-	if str, err = dec.ReadString(reflectedPdu, hdr); err != nil {
+
+	endOffset, err := dec.endOffset(length)
+	if err != nil {
 		return "", err
 	}
-	return str, nil
+	charset, err := dec.ReadCharset(nil, "")
+	if err != nil {
+		return "", err
+	}
+	if dec.Offset > endOffset {
+		return "", ErrorDecodeInconsistentOffset{dec.Offset, endOffset}
+	}
+	dec.log = dec.log + fmt.Sprintf("Next string encoded with: %s\n", charset)
+
+	raw := trimTextTerminator(dec.Data[dec.Offset+1:endOffset+1], charset)
+	dec.Offset = endOffset
+	v, err := DecodeCharset(raw, charset)
+	if err != nil {
+		log.Printf("Decoding %s: %v", hdr, err)
+		dec.log = dec.log + fmt.Sprintf("Decoding %s: %v\n", hdr, err)
+	}
+	dec.setPduField(reflectedPdu, hdr, v, setterString)
+	return v, nil
 }
 
 func (dec *MMSDecoder) ReadQ(reflectedPdu *reflect.Value) error {
-	v, err := dec.ReadUintVar(nil, "")
+	q, err := dec.readQ()
 	if err != nil {
 		return err
 	}
+	dec.setPduField(reflectedPdu, "Q", q, setterFloat64)
+	return nil
+}
+
+func (dec *MMSDecoder) readQ() (float64, error) {
+	v, err := dec.ReadUintVar(nil, "")
+	if err != nil {
+		return 0, err
+	}
 	q := float64(v)
 	if q > 100 {
 		q = (q - 100) / 1000
 	} else {
 		q = (q - 1) / 100
 	}
-	reflectedPdu.FieldByName("Q").SetFloat(q)
-	return nil
+	return q, nil
 }
 
 // ReadLength reads the length from the next position according to section
@@ -110,12 +207,15 @@ func (dec *MMSDecoder) ReadQ(reflectedPdu *reflect.Value) error {
 // Length-quote = <Octet 31>
 // Length = Uintvar-integer
 func (dec *MMSDecoder) ReadLength(reflectedPdu *reflect.Value) (length uint64, err error) {
+	if err := dec.ensure(1); err != nil {
+		return 0, err
+	}
 	switch {
 	case dec.Data[dec.Offset+1]&0x7f <= SHORT_LENGTH_MAX:
 		l, err := dec.ReadShortInteger(nil, "")
 		v := uint64(l)
 		if reflectedPdu != nil {
-			reflectedPdu.FieldByName("Length").SetUint(v)
+			dec.setPduField(reflectedPdu, "Length", v, setterUint64)
 		}
 		return v, err
 	case dec.Data[dec.Offset+1] == LENGTH_QUOTE:
@@ -132,7 +232,10 @@ func (dec *MMSDecoder) ReadLength(reflectedPdu *reflect.Value) (length uint64, e
 func (dec *MMSDecoder) ReadCharset(reflectedPdu *reflect.Value, hdr string) (string, error) {
 	var charset string
 
-	if dec.Data[dec.Offset] == ANY_CHARSET {
+	if err := dec.ensure(1); err != nil {
+		return "", err
+	}
+	if dec.Data[dec.Offset+1] == ANY_CHARSET {
 		dec.Offset++
 		charset = "*"
 	} else {
@@ -142,63 +245,78 @@ func (dec *MMSDecoder) ReadCharset(reflectedPdu *reflect.Value, hdr string) (str
 		}
 		var ok bool
 		if charset, ok = CHARSETS[charCode]; !ok {
-			return "", fmt.Errorf("Cannot find matching charset for %#x == %d", charCode, charCode)
+			// Don't fail decoding the whole message, fall back to UTF-8.
+			log.Printf("Cannot find matching charset for %#x == %d, falling back to UTF-8", charCode, charCode)
+			dec.log = dec.log + fmt.Sprintf("Unknown charset %#x, falling back to UTF-8\n", charCode)
+			charset = ""
 		}
 	}
 	if hdr != "" {
-		reflectedPdu.FieldByName("Charset").SetString(charset)
+		dec.setPduField(reflectedPdu, "Charset", charset, setterString)
 	}
 	return charset, nil
 }
 
-func (dec *MMSDecoder) ReadMediaType(reflectedPdu *reflect.Value, hdr string) (err error) {
-	var mediaType string
-	var endOffset int
-	origOffset := dec.Offset
+// ReadMediaType reads a Content-type-value and sets its media type on hdr,
+// the parameters are read but not kept.
+func (dec *MMSDecoder) ReadMediaType(reflectedPdu *reflect.Value, hdr string) error {
+	var ct Attachment
+	if err := dec.readContentType(&ct); err != nil {
+		return err
+	}
+	dec.setPduField(reflectedPdu, hdr, ct.MediaType, setterString)
+	return nil
+}
 
-	if dec.Data[dec.Offset+1] <= SHORT_LENGTH_MAX || dec.Data[dec.Offset+1] == LENGTH_QUOTE {
-		if length, err := dec.ReadLength(nil); err != nil {
-			return err
-		} else {
-			endOffset = int(length) + dec.Offset
-		}
+// readMediaType reads a Media-type without parameters as described in section
+// 8.4.2.24 of WAP-230-WSP-20010705-a.
+//
+// Media-type = (Well-known-media | Extension-Media)
+func (dec *MMSDecoder) readMediaType() (mediaType string, err error) {
+	origOffset := dec.Offset
+	if err := dec.ensure(1); err != nil {
+		return "", err
 	}
 
 	if dec.Data[dec.Offset+1] >= TEXT_MIN && dec.Data[dec.Offset+1] <= TEXT_MAX {
 		if mediaType, err = dec.ReadString(nil, ""); err != nil {
-			return err
+			return "", err
 		}
-	} else if mt, err := dec.ReadInteger(nil, ""); err == nil && len(CONTENT_TYPES) > int(mt) {
+	} else if mt, err := dec.ReadInteger(nil, ""); err == nil && mt < uint64(len(CONTENT_TYPES)) {
 		mediaType = CONTENT_TYPES[mt]
 	} else {
-		return fmt.Errorf("cannot decode media type for field beginning with %#x@%d", dec.Data[origOffset], origOffset)
+		return "", fmt.Errorf("cannot decode media type for field beginning with %#x@%d", dec.Data[origOffset], origOffset)
 	}
 
-	// skip the rest of the content type params
-	if endOffset > 0 {
-		dec.Offset = endOffset
-	}
-
-	reflectedPdu.FieldByName(hdr).SetString(mediaType)
-	dec.log = dec.log + fmt.Sprintf("%s: %s\n", hdr, mediaType)
-
-	return nil
+	dec.log = dec.log + fmt.Sprintf("Media type: %s\n", mediaType)
+	return mediaType, nil
 }
 
 func (dec *MMSDecoder) ReadTo(reflectedPdu *reflect.Value) error {
+	return dec.readAddressList(reflectedPdu, "To")
+}
+
+// readAddressList reads an address header value, which may be repeated, and
+// appends it to the name field in reflectedPdu.
+func (dec *MMSDecoder) readAddressList(reflectedPdu *reflect.Value, name string) error {
 	// field in the MMS protocol
-	toField, err := dec.ReadEncodedString(reflectedPdu, "")
+	address, err := dec.ReadEncodedString(nil, "")
 	if err != nil {
 		return err
 	}
 	// field in the golang structure
-	to := reflectedPdu.FieldByName("To")
-	toSlice := reflect.Append(to, reflect.ValueOf(toField))
-	reflectedPdu.FieldByName("To").Set(toSlice)
-	return err
+	field := reflectedPdu.FieldByName(name)
+	if !field.IsValid() || field.Type() != reflect.TypeOf([]string(nil)) {
+		return fmt.Errorf("field %s is not an address list in decoding structure", name)
+	}
+	field.Set(reflect.Append(field, reflect.ValueOf(address)))
+	return nil
 }
 
 func (dec *MMSDecoder) ReadString(reflectedPdu *reflect.Value, hdr string) (string, error) {
+	if err := dec.ensure(1); err != nil {
+		return "", err
+	}
 	dec.Offset++
 	if dec.Data[dec.Offset] == 34 { // Skip the quote char(34) == "
 		dec.Offset++
@@ -219,6 +337,9 @@ func (dec *MMSDecoder) ReadString(reflectedPdu *reflect.Value, hdr string) (stri
 }
 
 func (dec *MMSDecoder) ReadShortInteger(reflectedPdu *reflect.Value, hdr string) (byte, error) {
+	if err := dec.ensure(1); err != nil {
+		return 0, err
+	}
 	dec.Offset++
 	/*
 		TODO fix use of short when not short
@@ -233,6 +354,9 @@ func (dec *MMSDecoder) ReadShortInteger(reflectedPdu *reflect.Value, hdr string)
 }
 
 func (dec *MMSDecoder) ReadByte(reflectedPdu *reflect.Value, hdr string) (byte, error) {
+	if err := dec.ensure(1); err != nil {
+		return 0, err
+	}
 	dec.Offset++
 	v := dec.Data[dec.Offset]
 	dec.setPduField(reflectedPdu, hdr, uint64(v), setterUint64)
@@ -241,6 +365,12 @@ func (dec *MMSDecoder) ReadByte(reflectedPdu *reflect.Value, hdr string) (byte,
 }
 
 func (dec *MMSDecoder) ReadBoundedBytes(reflectedPdu *reflect.Value, hdr string, end int) ([]byte, error) {
+	if end > len(dec.Data) {
+		return nil, ErrorDecodeShortData{len(dec.Data), end}
+	}
+	if dec.Offset < 0 || dec.Offset > end {
+		return nil, ErrorDecodeInconsistentOffset{dec.Offset, end}
+	}
 	v := []byte(dec.Data[dec.Offset:end])
 	dec.setPduField(reflectedPdu, hdr, v, setterSlice)
 	dec.Offset = end - 1
@@ -252,8 +382,14 @@ func (dec *MMSDecoder) ReadBoundedBytes(reflectedPdu *reflect.Value, hdr string,
 // more octects available are indicated with the most significant bit
 // set to 1
 func (dec *MMSDecoder) ReadUintVar(reflectedPdu *reflect.Value, hdr string) (value uint64, err error) {
+	if err := dec.ensure(1); err != nil {
+		return 0, err
+	}
 	dec.Offset++
 	for dec.Data[dec.Offset]>>7 == 0x01 {
+		if err := dec.ensure(1); err != nil {
+			return 0, err
+		}
 		value = value << 7
 		value |= uint64(dec.Data[dec.Offset] & 0x7F)
 		dec.Offset++
@@ -267,6 +403,9 @@ func (dec *MMSDecoder) ReadUintVar(reflectedPdu *reflect.Value, hdr string) (val
 }
 
 func (dec *MMSDecoder) ReadInteger(reflectedPdu *reflect.Value, hdr string) (uint64, error) {
+	if err := dec.ensure(1); err != nil {
+		return 0, err
+	}
 	param := dec.Data[dec.Offset+1]
 	var v uint64
 	var err error
@@ -284,11 +423,17 @@ func (dec *MMSDecoder) ReadInteger(reflectedPdu *reflect.Value, hdr string) (uin
 }
 
 func (dec *MMSDecoder) ReadLongInteger(reflectedPdu *reflect.Value, hdr string) (uint64, error) {
+	if err := dec.ensure(1); err != nil {
+		return 0, err
+	}
 	dec.Offset++
 	size := int(dec.Data[dec.Offset])
 	if size > SHORT_LENGTH_MAX {
 		return 0, fmt.Errorf("cannot encode long integer, length was %d but expected %d", size, SHORT_LENGTH_MAX)
 	}
+	if err := dec.ensure(size); err != nil {
+		return 0, err
+	}
 	dec.Offset++
 	end := dec.Offset + size
 	var v uint64
@@ -318,54 +463,93 @@ func (dec *MMSDecoder) ReadLongInteger(reflectedPdu *reflect.Value, hdr string)
 // 7.3.15 (Delta-Seconds-Value) of OMA-TS-MMS_ENC-V1_3-20110913-A
 // Delta-seconds-value = Long-integer
 func (dec *MMSDecoder) ReadExpiry(reflectedPdu *reflect.Value, received time.Time) (expiry time.Time, err error) {
-	length, err := dec.ReadLength(nil)
+	tv, err := dec.readTimeValue()
 	if err != nil {
 		return expiry, err
 	}
-	endOffset := dec.Offset + int(length)
-	if endOffset >= len(dec.Data) {
-		return expiry, ErrorDecodeShortData{len(dec.Data), endOffset}
+	expiry = tv.Time(received)
+
+	if reflectedPdu != nil {
+		field := reflectedPdu.FieldByName("Expiry")
+		if field.IsValid() {
+			switch field.Type() {
+			case reflect.TypeOf(time.Time{}):
+				dec.setPduField(reflectedPdu, "Expiry", expiry, setterTime)
+			case reflect.TypeOf(TimeValue{}):
+				dec.setPduField(reflectedPdu, "Expiry", tv, setterTime)
+			default:
+				log.Printf("Field Expiry in decoding structure is not a time.Time type")
+			}
+		} else {
+			log.Printf("Field Expiry is not in decoding structure")
+		}
 	}
+	dec.log = dec.log + fmt.Sprintf("Message Expiry %v\n", expiry)
+	return expiry, nil
+}
 
-	var token uint8
-	token, err = dec.ReadByte(nil, "")
+// readTimeValue reads the value of the X-Mms-Expiry, X-Mms-Delivery-Time and X-Mms-Reply-Charging-Deadline
+// headers as defined in OMA-WAP-MMS-ENC-v1.1 sections 7.2.10 and 7.2.12.
+//
+// Delivery-time-value = Value-length (Absolute-token Date-value | Relative-token Delta-seconds-value)
+func (dec *MMSDecoder) readTimeValue() (tv TimeValue, err error) {
+	length, err := dec.ReadLength(nil)
 	if err != nil {
-		return expiry, err
+		return tv, err
 	}
-	if token != ExpiryTokenAbsolute && token != ExpiryTokenRelative {
-		return expiry, ErrorDecodeUnknownExpiryToken(token)
+	endOffset, err := dec.endOffset(length)
+	if err != nil {
+		return tv, err
 	}
 
-	var value uint64
-	value, err = dec.ReadLongInteger(nil, "")
+	token, err := dec.ReadByte(nil, "")
 	if err != nil {
-		return expiry, err
+		return tv, err
+	}
+	if token != ExpiryTokenAbsolute && token != ExpiryTokenRelative {
+		return tv, ErrorDecodeUnknownExpiryToken(token)
 	}
 
+	if tv.Seconds, err = dec.ReadLongInteger(nil, ""); err != nil {
+		return tv, err
+	}
 	if dec.Offset != endOffset {
-		return expiry, ErrorDecodeInconsistentOffset{dec.Offset, endOffset}
+		return tv, ErrorDecodeInconsistentOffset{dec.Offset, endOffset}
 	}
+	tv.Absolute = token == ExpiryTokenAbsolute
+	return tv, nil
+}
 
-	if token == ExpiryTokenRelative {
-		expiry = received.Add(time.Duration(value) * time.Second)
-	} else {
-		expiry = time.Unix(int64(value), 0)
+// readFrom reads a From-value as defined in OMA-WAP-MMS-ENC-v1.1 section 7.2.11,
+// an empty string is returned for the Insert-address-token.
+//
+// From-value = Value-length (Address-present-token Encoded-string-value | Insert-address-token)
+func (dec *MMSDecoder) readFrom() (from string, err error) {
+	// The Value-length is read as a single octet, as some carriers send
+	// values longer than a Short-length without a Length-quote.
+	size, err := dec.ReadByte(nil, "")
+	if err != nil {
+		return "", err
 	}
-
-	if reflectedPdu != nil {
-		field := reflectedPdu.FieldByName("Expiry")
-		if field.IsValid() {
-			if field.Type() == reflect.TypeOf(time.Time{}) {
-				dec.setPduField(reflectedPdu, "Expiry", expiry, setterTime)
-			} else {
-				log.Printf("Field Expiry in decoding structure is not a time.Time type")
-			}
-		} else {
-			log.Printf("Field Expiry is not in decoding structure")
+	valStart := dec.Offset
+	token, err := dec.ReadByte(nil, "")
+	if err != nil {
+		return "", err
+	}
+	switch token {
+	case TOKEN_INSERT_ADDRESS:
+	case TOKEN_ADDRESS_PRESENT:
+		// TODO add check for /TYPE=PLMN
+		if from, err = dec.ReadEncodedString(nil, ""); err != nil {
+			return "", err
 		}
+		if valStart+int(size) != dec.Offset {
+			return "", fmt.Errorf("From field length is %d but expected size is %d", dec.Offset-valStart, size)
+		}
+	default:
+		return "", fmt.Errorf("Unhandled token address in from field %x", token)
 	}
-	dec.log = dec.log + fmt.Sprintf("Message Expiry %v\n", expiry)
-	return expiry, nil
+	return from, nil
 }
 
 //getParam reads the next parameter to decode and returns it if it's well known
@@ -392,33 +576,32 @@ func (dec *MMSDecoder) getParam() (byte, bool, error) {
 }
 
 func (dec *MMSDecoder) skipFieldValue() error {
+	if err := dec.ensure(1); err != nil {
+		return err
+	}
 	switch {
 	case dec.Data[dec.Offset+1] < LENGTH_QUOTE:
 		l, err := dec.ReadByte(nil, "")
 		if err != nil {
 			return err
 		}
-		length := int(l)
-		if dec.Offset+length >= len(dec.Data) {
-			return fmt.Errorf("Bad field value length")
+		endOffset, err := dec.endOffset(uint64(l))
+		if err != nil {
+			return err
 		}
-		dec.Offset += length
+		dec.Offset = endOffset
 		return nil
 	case dec.Data[dec.Offset+1] == LENGTH_QUOTE:
 		dec.Offset++
-		// TODO These tests should be done in basic read functions
-		if dec.Offset+1 >= len(dec.Data) {
-			return fmt.Errorf("Bad uintvar")
-		}
 		l, err := dec.ReadUintVar(nil, "")
 		if err != nil {
 			return err
 		}
-		length := int(l)
-		if dec.Offset+length >= len(dec.Data) {
-			return fmt.Errorf("Bad field value length")
+		endOffset, err := dec.endOffset(l)
+		if err != nil {
+			return err
 		}
-		dec.Offset += length
+		dec.Offset = endOffset
 		return nil
 	case dec.Data[dec.Offset+1] <= TEXT_MAX:
 		_, err := dec.ReadString(nil, "")
@@ -429,13 +612,24 @@ func (dec *MMSDecoder) skipFieldValue() error {
 	return err
 }
 
-func (dec *MMSDecoder) Decode(pdu MMSReader) (err error) {
+// Decode decodes the headers and body of the PDU in the decoder data into pdu.
+// PDUs that know how to decode themselves are decoded without reflection,
+// any other structure is filled through reflection by matching field names.
+func (dec *MMSDecoder) Decode(pdu MMSReader) error {
+	if p, ok := pdu.(pduDecoder); ok {
+		return p.decode(dec)
+	}
+	return dec.decodeFields(pdu)
+}
+
+func (dec *MMSDecoder) decodeFields(pdu MMSReader) (err error) {
 	reflectedPdu := reflect.ValueOf(pdu).Elem()
 	moreHdrToRead := true
 	//fmt.Printf("len data: %d, data: %x\n", len(dec.Data), dec.Data)
 	for ; (dec.Offset < len(dec.Data)) && moreHdrToRead; dec.Offset++ {
 		//fmt.Printf("offset %d, value: %x\n", dec.Offset, dec.Data[dec.Offset])
 		err = nil
+		hdrOffset := dec.Offset
 		param, needsDecoding, err := dec.getParam()
 		if err != nil {
 			return err
@@ -444,31 +638,18 @@ func (dec *MMSDecoder) Decode(pdu MMSReader) (err error) {
 		}
 		switch param {
 		case X_MMS_MESSAGE_TYPE:
-			dec.Offset++
-			expectedType := byte(reflectedPdu.FieldByName("Type").Uint())
-			parsedType := dec.Data[dec.Offset]
+			var parsedType byte
+			if parsedType, err = dec.ReadByte(nil, ""); err != nil {
+				break
+			}
 			//Unknown message types will be discarded. OMA-WAP-MMS-ENC-v1.1 section 7.2.16
-			if parsedType != expectedType {
-				err = fmt.Errorf("Expected message type %x got %x", expectedType, parsedType)
+			if expected := reflectedPdu.FieldByName("Type"); expected.IsValid() && parsedType != byte(expected.Uint()) {
+				err = fmt.Errorf("Expected message type %x got %x", expected.Uint(), parsedType)
 			}
 		case FROM:
-			dec.Offset++
-			size := int(dec.Data[dec.Offset])
-			valStart := dec.Offset
-			dec.Offset++
-			token := dec.Data[dec.Offset]
-			switch token {
-			case TOKEN_INSERT_ADDRESS:
-				break
-			case TOKEN_ADDRESS_PRESENT:
-				// TODO add check for /TYPE=PLMN
-				_, err = dec.ReadEncodedString(&reflectedPdu, "From")
-				if valStart+size != dec.Offset {
-					err = fmt.Errorf("From field length is %d but expected size is %d",
-						dec.Offset-valStart, size)
-				}
-			default:
-				err = fmt.Errorf("Unhandled token address in from field %x", token)
+			var from string
+			if from, err = dec.readFrom(); err == nil && from != "" {
+				dec.setPduField(&reflectedPdu, "From", from, setterString)
 			}
 		case X_MMS_EXPIRY:
 			received := time.Time{}
@@ -482,12 +663,20 @@ func (dec *MMSDecoder) Decode(pdu MMSReader) (err error) {
 				log.Printf("Field Received is not in decoding structure")
 			}
 			_, err = dec.ReadExpiry(&reflectedPdu, received)
+		case X_MMS_DELIVERY_TIME:
+			var deliveryTime TimeValue
+			if deliveryTime, err = dec.readTimeValue(); err == nil {
+				dec.setPduField(&reflectedPdu, "DeliveryTime", deliveryTime, setterTime)
+			}
 		case X_MMS_TRANSACTION_ID:
 			_, err = dec.ReadString(&reflectedPdu, "TransactionId")
 		case CONTENT_TYPE:
 			ctMember := reflectedPdu.FieldByName("Content")
+			if !ctMember.IsValid() || !reflectedPdu.FieldByName("Attachments").IsValid() {
+				return ErrorDecodeHeader{param, hdrOffset, fmt.Errorf("%T cannot hold content", pdu)}
+			}
 			if err = dec.ReadAttachment(&ctMember); err != nil {
-				return err
+				return ErrorDecodeHeader{param, hdrOffset, err}
 			}
 			//application/vnd.wap.multipart.related and others
 			if ctMember.FieldByName("MediaType").String() != "text/plain" {
@@ -507,7 +696,9 @@ func (dec *MMSDecoder) Decode(pdu MMSReader) (err error) {
 		case TO:
 			err = dec.ReadTo(&reflectedPdu)
 		case CC:
-			_, err = dec.ReadEncodedString(&reflectedPdu, "Cc")
+			err = dec.readAddressList(&reflectedPdu, "Cc")
+		case BCC:
+			err = dec.readAddressList(&reflectedPdu, "Bcc")
 		case X_MMS_REPLY_CHARGING_ID:
 			_, err = dec.ReadString(&reflectedPdu, "ReplyChargingId")
 		case X_MMS_RETRIEVE_TEXT:
@@ -525,13 +716,20 @@ func (dec *MMSDecoder) Decode(pdu MMSReader) (err error) {
 		case X_MMS_REPLY_CHARGING:
 			_, err = dec.ReadByte(&reflectedPdu, "ReplyCharging")
 		case X_MMS_REPLY_CHARGING_DEADLINE:
-			_, err = dec.ReadByte(&reflectedPdu, "ReplyChargingDeadLine")
+			var deadline TimeValue
+			if deadline, err = dec.readTimeValue(); err == nil {
+				dec.setPduField(&reflectedPdu, "ReplyChargingDeadline", deadline, setterTime)
+			}
 		case X_MMS_PRIORITY:
 			_, err = dec.ReadByte(&reflectedPdu, "Priority")
 		case X_MMS_RETRIEVE_STATUS:
 			_, err = dec.ReadByte(&reflectedPdu, "RetrieveStatus")
 		case X_MMS_RESPONSE_STATUS:
 			_, err = dec.ReadByte(&reflectedPdu, "ResponseStatus")
+		case X_MMS_STATUS:
+			_, err = dec.ReadByte(&reflectedPdu, "Status")
+		case X_MMS_READ_STATUS:
+			_, err = dec.ReadByte(&reflectedPdu, "ReadStatus")
 		case X_MMS_RESPONSE_TEXT:
 			_, err = dec.ReadString(&reflectedPdu, "ResponseText")
 		case X_MMS_DELIVERY_REPORT:
@@ -547,7 +745,7 @@ func (dec *MMSDecoder) Decode(pdu MMSReader) (err error) {
 			err = dec.skipFieldValue()
 		}
 		if err != nil {
-			return err
+			return ErrorDecodeHeader{param, hdrOffset, err}
 		}
 	}
 	return nil
@@ -0,0 +1,42 @@
+//go:build go1.18
+// +build go1.18
+
+package mms
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// FuzzDecode feeds arbitrary data to the decoder for every PDU we receive,
+// decoding must fail with an error and never panic.
+func FuzzDecode(f *testing.F) {
+	payloads, err := filepath.Glob("test_payloads/*")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, payload := range payloads {
+		data, err := ioutil.ReadFile(payload)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{0x8c, 0x86, 0x8d, 0x92, 0x8b, 0x61, 0x00, 0x97, 0x61, 0x00, 0x85, 0x04, 0x5b, 0x2e, 0x9f, 0xc0, 0x95, 0x81})
+	f.Add([]byte{0x8c, 0x88, 0x8d, 0x92, 0x8b, 0x61, 0x00, 0x97, 0x61, 0x00, 0x89, 0x03, 0x80, 0x62, 0x00, 0x9b, 0x80})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pdus := []MMSReader{
+			NewMNotificationInd(time.Time{}),
+			NewMRetrieveConf("fuzz"),
+			NewMSendConf(),
+			NewMDeliveryInd(),
+			NewMReadOrigInd(),
+		}
+		for _, pdu := range pdus {
+			NewDecoder(data).Decode(pdu)
+		}
+	})
+}
@@ -22,6 +22,7 @@
 package mms
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"reflect"
@@ -108,7 +109,7 @@ func TestMMSDecoder_ReadExpiry(t *testing.T) {
 		{
 			"error-value-length",
 			[]byte{0x88, 0x04, 0x81, 0x03, 0x01, 0x2c}, 0, &MNotificationInd{}, time20000101,
-			time.Time{}, ErrorDecodeShortData{4, 6}, 1, "runtime error: index out of range [6] with length 6",
+			time.Time{}, ErrorDecodeShortData{6, 6}, 3, nil,
 		},
 		{
 			"error-unknown-token",
@@ -182,3 +183,327 @@ func TestMMSDecoder_ReadExpiry(t *testing.T) {
 		})
 	}
 }
+
+func (s *DecoderTestSuite) TestDecodeMDeliveryInd(c *C) {
+	inputBytes := []byte{
+		// Message Type m-delivery.ind
+		0x8C, 0x86,
+		// MMS Version 1.0
+		0x8D, 0x90,
+		// Message Id "abc"
+		0x8B, 0x61, 0x62, 0x63, 0x00,
+		// To "+12345/TYPE=PLMN"
+		0x97, 0x2B, 0x31, 0x32, 0x33, 0x34, 0x35, 0x2F, 0x54, 0x59, 0x50, 0x45, 0x3D, 0x50, 0x4C, 0x4D, 0x4E, 0x00,
+		// Date
+		0x85, 0x04, 0x5A, 0x0B, 0x0C, 0x0D,
+		// Status retrieved
+		0x95, 0x81,
+	}
+	mDeliveryInd := NewMDeliveryInd()
+	dec := NewDecoder(inputBytes)
+	c.Assert(dec.Decode(mDeliveryInd), IsNil)
+	c.Check(mDeliveryInd.Type, Equals, byte(TYPE_DELIVERY_IND))
+	c.Check(mDeliveryInd.Version, Equals, byte(MMS_MESSAGE_VERSION_1_0))
+	c.Check(mDeliveryInd.MessageId, Equals, "abc")
+	c.Check(mDeliveryInd.To, DeepEquals, []string{"+12345/TYPE=PLMN"})
+	c.Check(mDeliveryInd.Date, Equals, uint64(0x5A0B0C0D))
+	c.Check(mDeliveryInd.Status, Equals, byte(STATUS_RETRIEVED))
+}
+
+func (s *DecoderTestSuite) TestGetMessageType(c *C) {
+	messageType, err := GetMessageType([]byte{0x8C, 0x86, 0x8D, 0x90})
+	c.Check(err, IsNil)
+	c.Check(messageType, Equals, byte(TYPE_DELIVERY_IND))
+
+	_, err = GetMessageType([]byte{0x8C})
+	c.Check(err, DeepEquals, ErrorDecodeShortData{1, 2})
+
+	_, err = GetMessageType([]byte{0x8D, 0x90})
+	c.Check(err, NotNil)
+}
+
+func (s *DecoderTestSuite) TestDecodeMReadOrigInd(c *C) {
+	inputBytes := []byte{
+		// Message Type m-read-orig.ind
+		0x8C, 0x88,
+		// MMS Version 1.1
+		0x8D, 0x91,
+		// Message Id "abc"
+		0x8B, 0x61, 0x62, 0x63, 0x00,
+		// To "+12345/TYPE=PLMN"
+		0x97, 0x2B, 0x31, 0x32, 0x33, 0x34, 0x35, 0x2F, 0x54, 0x59, 0x50, 0x45, 0x3D, 0x50, 0x4C, 0x4D, 0x4E, 0x00,
+		// From "+6789/TYPE=PLMN"
+		0x89, 0x11, 0x80, 0x2B, 0x36, 0x37, 0x38, 0x39, 0x2F, 0x54, 0x59, 0x50, 0x45, 0x3D, 0x50, 0x4C, 0x4D, 0x4E, 0x00,
+		// Date
+		0x85, 0x04, 0x5A, 0x0B, 0x0C, 0x0D,
+		// Read Status read
+		0x9B, 0x80,
+	}
+	mReadOrigInd := NewMReadOrigInd()
+	dec := NewDecoder(inputBytes)
+	c.Assert(dec.Decode(mReadOrigInd), IsNil)
+	c.Check(mReadOrigInd.Type, Equals, byte(TYPE_READ_ORIG_IND))
+	c.Check(mReadOrigInd.MessageId, Equals, "abc")
+	c.Check(mReadOrigInd.To, DeepEquals, []string{"+12345/TYPE=PLMN"})
+	c.Check(mReadOrigInd.From, Equals, "+6789/TYPE=PLMN")
+	c.Check(mReadOrigInd.Date, Equals, uint64(0x5A0B0C0D))
+	c.Check(mReadOrigInd.ReadStatus, Equals, ReadStatusRead)
+}
+
+func TestMMSDecoder_ReadEncodedString(t *testing.T) {
+	testCases := []struct {
+		name       string
+		bytes      []byte
+		want       string
+		wantOffset int
+	}{
+		{
+			"no-charset",
+			[]byte{0x80, 0x48, 0x65, 0x79, 0x00},
+			"Hey", 4,
+		},
+		{
+			"utf-8",
+			[]byte{0x80, 0x05, 0xea, 0x48, 0xc3, 0xa9, 0x00},
+			"Hé", 6,
+		},
+		{
+			"utf-16-bom",
+			[]byte{0x80, 0x0b, 0x02, 0x03, 0xf7, 0xfe, 0xff, 0x00, 0x48, 0x00, 0xe9, 0x00, 0x00},
+			"Hé", 12,
+		},
+		{
+			"ucs-2",
+			[]byte{0x80, 0x09, 0x02, 0x03, 0xe8, 0x00, 0x48, 0x00, 0xe9, 0x00, 0x00},
+			"Hé", 10,
+		},
+		{
+			"iso-8859-1",
+			[]byte{0x80, 0x06, 0x84, 0x63, 0x61, 0x66, 0xe9, 0x00},
+			"café", 7,
+		},
+		{
+			"shift_jis",
+			[]byte{0x80, 0x06, 0x91, 0x93, 0xfa, 0x96, 0x7b, 0x00},
+			"日本", 7,
+		},
+		{
+			"unknown-charset-fallback",
+			[]byte{0x80, 0x05, 0xfe, 0x61, 0x62, 0x63, 0x00},
+			"abc", 6,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := NewDecoder(tc.bytes)
+			got, err := dec.ReadEncodedString(nil, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+			if dec.Offset != tc.wantOffset {
+				t.Errorf("got offset %d, want %d", dec.Offset, tc.wantOffset)
+			}
+		})
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    []byte
+		charset string
+		want    string
+		wantErr error
+	}{
+		{"empty-charset", []byte("abc"), "", "abc", nil},
+		{"utf-8", []byte("Hé"), "utf-8", "Hé", nil},
+		{"windows-1251", []byte{0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2}, "windows-1251", "Привет", nil},
+		{"gb2312", []byte{0xc4, 0xe3, 0xba, 0xc3}, "gb2312", "你好", nil},
+		{"utf-16le", []byte{0x48, 0x00, 0xe9, 0x00}, "utf-16le", "Hé", nil},
+		{"unsupported", []byte("abc"), "x-unknown", "abc", ErrorUnsupportedCharset("x-unknown")},
+		{"unsupported-invalid-utf8", []byte{0x61, 0xff}, "x-unknown", "a�", ErrorUnsupportedCharset("x-unknown")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodeCharset(tc.data, tc.charset)
+			if err != tc.wantErr {
+				t.Errorf("got error %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMMSDecoder_ReadShortData(t *testing.T) {
+	testCases := []struct {
+		name  string
+		bytes []byte
+		read  func(dec *MMSDecoder) error
+	}{
+		{"uintvar-empty", []byte{0x00}, func(dec *MMSDecoder) error { _, err := dec.ReadUintVar(nil, ""); return err }},
+		{"uintvar-continued", []byte{0x00, 0x81, 0x82}, func(dec *MMSDecoder) error { _, err := dec.ReadUintVar(nil, ""); return err }},
+		{"short-integer", []byte{0x00}, func(dec *MMSDecoder) error { _, err := dec.ReadShortInteger(nil, ""); return err }},
+		{"byte", []byte{0x00}, func(dec *MMSDecoder) error { _, err := dec.ReadByte(nil, ""); return err }},
+		{"length", []byte{0x00}, func(dec *MMSDecoder) error { _, err := dec.ReadLength(nil); return err }},
+		{"length-quoted", []byte{0x00, LENGTH_QUOTE}, func(dec *MMSDecoder) error { _, err := dec.ReadLength(nil); return err }},
+		{"integer", []byte{0x00}, func(dec *MMSDecoder) error { _, err := dec.ReadInteger(nil, ""); return err }},
+		{"long-integer", []byte{0x00, 0x03, 0x01, 0x02}, func(dec *MMSDecoder) error { _, err := dec.ReadLongInteger(nil, ""); return err }},
+		{"string", []byte{0x00}, func(dec *MMSDecoder) error { _, err := dec.ReadString(nil, ""); return err }},
+		{"encoded-string", []byte{0x00, 0x0a, 0xea, 0x61}, func(dec *MMSDecoder) error { _, err := dec.ReadEncodedString(nil, ""); return err }},
+		{"charset", []byte{0x00}, func(dec *MMSDecoder) error { _, err := dec.ReadCharset(nil, ""); return err }},
+		{"media-type", []byte{0x00, 0x05, 0x83}, func(dec *MMSDecoder) error {
+			v := reflect.ValueOf(&Attachment{}).Elem()
+			return dec.ReadMediaType(&v, "MediaType")
+		}},
+		{"bounded-bytes", []byte{0x00, 0x01}, func(dec *MMSDecoder) error { _, err := dec.ReadBoundedBytes(nil, "", 3); return err }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.read(NewDecoder(tc.bytes))
+			if _, ok := err.(ErrorDecodeShortData); !ok {
+				t.Errorf("got error %#v, want ErrorDecodeShortData", err)
+			}
+		})
+	}
+}
+
+func (s *DecoderTestSuite) TestDecodeTruncatedHeader(c *C) {
+	inputBytes := []byte{
+		// Message Type m-delivery.ind
+		0x8C, 0x86,
+		// Message Id "ab" without terminator
+		0x8B, 0x61, 0x62,
+	}
+	err := NewDecoder(inputBytes).Decode(NewMDeliveryInd())
+	c.Assert(err, FitsTypeOf, ErrorDecodeHeader{})
+	c.Check(err.(ErrorDecodeHeader).Header, Equals, byte(MESSAGE_ID))
+	c.Check(err.(ErrorDecodeHeader).Offset, Equals, 2)
+
+	inputBytes = []byte{
+		// Message Type m-delivery.ind
+		0x8C, 0x86,
+		// Date with a long integer longer than the data
+		0x85, 0x04, 0x01,
+	}
+	err = NewDecoder(inputBytes).Decode(NewMDeliveryInd())
+	c.Assert(err, FitsTypeOf, ErrorDecodeHeader{})
+	c.Check(errors.Unwrap(err), DeepEquals, ErrorDecodeShortData{5, 7})
+}
+
+func TestMMSDecoder_ReadContentType(t *testing.T) {
+	testCases := []struct {
+		name       string
+		bytes      []byte
+		want       Attachment
+		wantOffset int
+	}{
+		{
+			"constrained",
+			[]byte{0x00, 0x83, 0x00},
+			Attachment{MediaType: "text/plain"}, 1,
+		},
+		{
+			"multipart-related",
+			append(append(append([]byte{0x00, 27, 0xb3, 0x89},
+				"application/smil\x00"...), 0x99),
+				"<smil>\x00\x00"...),
+			Attachment{
+				MediaType: "application/vnd.wap.multipart.related",
+				Type:      "application/smil",
+				Start:     "<smil>",
+				Length:    27,
+			}, 28,
+		},
+		{
+			"part",
+			append([]byte{0x00, LENGTH_QUOTE, 52, 0x83, 0x81, 0xea, 0x97},
+				"hello.txt\x00\x98\"file.txt\x00\x96\x85\x93\x02\x01\x00\x90\x00\x82\x92x-foo\x00bar\x00X-Bar\x00\x85\x00"...),
+			Attachment{
+				MediaType:    "text/plain",
+				Charset:      "utf-8",
+				Name:         "hello.txt",
+				FileName:     "file.txt",
+				Size:         5,
+				CreationDate: 256,
+				Secure:       true,
+				Level:        0x12,
+				Length:       52,
+				Params:       map[string]string{"x-foo": "bar", "x-bar": "5"},
+			}, 54,
+		},
+		{
+			"text-level",
+			append([]byte{0x00, 6, 0x83, 0x82}, "1.2\x00\x00"...),
+			Attachment{MediaType: "text/plain", Level: 0x12, Length: 6}, 7,
+		},
+		{
+			"unknown-parameter",
+			append([]byte{0x00, 9, 0x9e, 0x81, 0xea, 0x9f, 0x01, 0x02, 0x97}, "a\x00\x00"...),
+			Attachment{MediaType: "image/jpeg", Charset: "utf-8", Length: 9}, 10,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := NewDecoder(tc.bytes)
+			var got Attachment
+			if err := dec.readContentType(&got); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+			if dec.Offset != tc.wantOffset {
+				t.Errorf("got offset %d, want %d", dec.Offset, tc.wantOffset)
+			}
+		})
+	}
+}
+
+func (s *DecoderTestSuite) TestDecodeNestedMultipart(c *C) {
+	var alternative bytes.Buffer
+	c.Assert(NewEncoder(&alternative).writeAttachments([]*Attachment{
+		{MediaType: "text/plain", Charset: "utf-8", ContentId: "<text>", Data: []byte("text")},
+		{MediaType: "text/html", Charset: "utf-8", ContentId: "<html>", Data: []byte("<p>html</p>")},
+	}), IsNil)
+	mRetrieveConf := &MRetrieveConf{
+		Type:          TYPE_RETRIEVE_CONF,
+		TransactionId: "1234567890",
+		Version:       MMS_MESSAGE_VERSION_1_1,
+		Content:       Attachment{MediaType: "application/vnd.wap.multipart.mixed"},
+		Attachments: []Attachment{
+			{MediaType: "application/smil", ContentId: "<smil>", Data: []byte("<smil></smil>")},
+			{MediaType: "multipart/alternative", ContentId: "<alternative>", Data: alternative.Bytes()},
+			{MediaType: "image/jpeg", ContentId: "<image>", Data: []byte{0xff, 0xd8, 0xff}},
+			// Claims 5 parts but holds none, kept as a single part.
+			{MediaType: "multipart/mixed", ContentId: "<broken>", Data: []byte{0x05}},
+		},
+	}
+	data, err := mRetrieveConf.MarshalBinary()
+	c.Assert(err, IsNil)
+
+	decoded := NewMRetrieveConf("")
+	c.Assert(NewDecoder(data).Decode(decoded), IsNil)
+	c.Assert(decoded.Attachments, HasLen, 4)
+	c.Check(decoded.Attachments[1].Parts, HasLen, 2)
+	c.Check(decoded.Attachments[3].Parts, IsNil)
+
+	smil, err := decoded.GetSmil()
+	c.Assert(err, IsNil)
+	c.Check(smil, Equals, "<smil></smil>")
+
+	var ids []string
+	for _, part := range decoded.GetDataParts() {
+		ids = append(ids, part.ContentId)
+		c.Check(data[part.Offset:part.Offset+len(part.Data)], DeepEquals, part.Data)
+	}
+	c.Check(ids, DeepEquals, []string{"<text>", "<html>", "<image>", "<broken>"})
+}
@@ -23,6 +23,8 @@ package mms
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
 
 	. "launchpad.net/gocheck"
 )
@@ -108,3 +110,56 @@ func (s *EncodeDecodeTestSuite) TestLength(c *C) {
 		c.Check(integer, Equals, testLengths[i], Commentf("%d != %d with encoded bytes starting at %d: %d", integer, testLengths[i], s.dec.Offset, bytes))
 	}
 }
+
+func (s *EncodeDecodeTestSuite) TestEncodedString(c *C) {
+	testStrs := []string{
+		"Hello World!",
+		"Привет, мир",
+		"Καλημέρα κόσμε",
+		"こんにちは世界",
+		"A longer subject with ünïcödé characters to require a quoted length",
+	}
+	for i := range testStrs {
+		c.Assert(s.enc.writeEncodedStringParam(SUBJECT, testStrs[i]), IsNil)
+	}
+	bytes := s.bytes.Bytes()
+	s.dec = NewDecoder(bytes)
+	for i := range testStrs {
+		param, err := s.dec.ReadByte(nil, "")
+		c.Assert(err, IsNil)
+		c.Check(param, Equals, byte(SUBJECT|SHORT_FILTER))
+		str, err := s.dec.ReadEncodedString(nil, "")
+		c.Assert(err, IsNil)
+		c.Check(str, Equals, testStrs[i], Commentf("with encoded bytes starting at %d: %#x", s.dec.Offset, bytes))
+	}
+}
+
+func (s *EncodeDecodeTestSuite) TestMSendReqSubjectAndTextCharset(c *C) {
+	text := "Γειά σου, 你好"
+	tmp, err := ioutil.TempFile("", "")
+	c.Assert(err, IsNil)
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	c.Assert(ioutil.WriteFile(tmp.Name(), []byte(text), 0644), IsNil)
+
+	att, err := NewAttachment("text0.txt", "text/plain", tmp.Name())
+	c.Assert(err, IsNil)
+	c.Check(att.Charset, Equals, "utf-8")
+
+	mSendReq := NewMSendReq([]string{"+12345"}, []*Attachment{att}, false, false)
+	mSendReq.Subject = "Тема сообщения"
+
+	var outBytes bytes.Buffer
+	c.Assert(NewEncoder(&outBytes).Encode(mSendReq), IsNil)
+
+	// m-send.req and m-retrieve.conf share the headers and body encoding.
+	pdu := &MRetrieveConf{Type: TYPE_SEND_REQ}
+	c.Assert(NewDecoder(outBytes.Bytes()).Decode(pdu), IsNil)
+	c.Check(pdu.Subject, Equals, mSendReq.Subject)
+	c.Assert(pdu.Attachments, HasLen, 1)
+	c.Check(pdu.Attachments[0].MediaType, Equals, "text/plain;charset=utf-8")
+	c.Check(pdu.Attachments[0].Charset, Equals, "utf-8")
+	got, err := pdu.Attachments[0].Text()
+	c.Assert(err, IsNil)
+	c.Check(got, Equals, text)
+}
@@ -28,6 +28,7 @@ import (
 	"io"
 	"log"
 	"reflect"
+	"strings"
 )
 
 type MMSEncoder struct {
@@ -39,7 +40,17 @@ func NewEncoder(w io.Writer) *MMSEncoder {
 	return &MMSEncoder{w: w}
 }
 
+// Encode writes pdu encoded as defined in OMA-WAP-MMS-ENC.
+// PDUs that know how to encode themselves are encoded without reflection,
+// any other structure is encoded through reflection by matching field names.
 func (enc *MMSEncoder) Encode(pdu MMSWriter) error {
+	if p, ok := pdu.(pduEncoder); ok {
+		return p.encode(enc)
+	}
+	return enc.encodeFields(pdu)
+}
+
+func (enc *MMSEncoder) encodeFields(pdu MMSWriter) error {
 	rPdu := reflect.ValueOf(pdu).Elem()
 
 	//The order of the following fields doesn't matter much
@@ -72,15 +83,20 @@ func (enc *MMSEncoder) Encode(pdu MMSWriter) error {
 			err = enc.writeStringParam(X_MMS_TRANSACTION_ID, f.String())
 		case "Status":
 			err = enc.writeByteParam(X_MMS_STATUS, byte(f.Uint()))
+		case "MessageId":
+			err = enc.writeStringParam(MESSAGE_ID, f.String())
+		case "Subject":
+			err = enc.writeEncodedStringParam(SUBJECT, f.String())
 		case "From":
 			err = enc.writeFrom()
 		case "Name":
 			err = enc.writeStringParam(WSP_PARAMETER_TYPE_NAME_DEFUNCT, f.String())
 		case "Start":
 			err = enc.writeStringParam(WSP_PARAMETER_TYPE_START_DEFUNCT, f.String())
-		case "To":
+		case "To", "Cc", "Bcc":
+			param := map[string]byte{"To": TO, "Cc": CC, "Bcc": BCC}[fieldName]
 			for i := 0; i < f.Len(); i++ {
-				err = enc.writeStringParam(TO, f.Index(i).String())
+				err = enc.writeStringParam(param, f.Index(i).String())
 				if err != nil {
 					break
 				}
@@ -91,7 +107,7 @@ func (enc *MMSEncoder) Encode(pdu MMSWriter) error {
 				if err := enc.setParam(CONTENT_TYPE); err != nil {
 					return err
 				}
-				if err = enc.writeContentType(mSendReq.ContentType, mSendReq.ContentTypeStart, mSendReq.ContentTypeType, ""); err != nil {
+				if err = enc.writeContentType(mSendReq.ContentType, mSendReq.ContentTypeStart, mSendReq.ContentTypeType, "", ""); err != nil {
 					return err
 				}
 				err = enc.writeAttachments(mSendReq.Attachments)
@@ -100,7 +116,7 @@ func (enc *MMSEncoder) Encode(pdu MMSWriter) error {
 			}
 		case "MediaType":
 			if a, ok := pdu.(*Attachment); ok {
-				if err = enc.writeContentType(a.MediaType, "", "", a.Name); err != nil {
+				if err = enc.writeContentType(a.MediaType, "", "", a.Name, a.Charset); err != nil {
 					return err
 				}
 			} else {
@@ -108,9 +124,6 @@ func (enc *MMSEncoder) Encode(pdu MMSWriter) error {
 					return err
 				}
 			}
-		case "Charset":
-			//TODO
-			err = enc.writeCharset(f.String())
 		case "ContentLocation":
 			err = enc.writeStringParam(MMS_PART_CONTENT_LOCATION, f.String())
 		case "ContentId":
@@ -128,10 +141,16 @@ func (enc *MMSEncoder) Encode(pdu MMSWriter) error {
 			err = enc.writeByteParam(X_MMS_DELIVERY_REPORT, byte(f.Uint()))
 		case "ReadReport":
 			err = enc.writeByteParam(X_MMS_READ_REPORT, byte(f.Uint()))
-		case "Expiry":
-			expiry := f.Uint()
-			if expiry > 0 {
-				err = enc.writeRelativeExpiry(expiry)
+		case "ReadStatus":
+			err = enc.writeByteParam(X_MMS_READ_STATUS, byte(f.Uint()))
+		case "Expiry", "DeliveryTime":
+			param := map[string]byte{"Expiry": X_MMS_EXPIRY, "DeliveryTime": X_MMS_DELIVERY_TIME}[fieldName]
+			if tv := f.Interface().(TimeValue); !tv.IsZero() {
+				err = enc.writeTimeValueParam(param, tv)
+			}
+		case "Priority":
+			if priority := byte(f.Uint()); priority > 0 {
+				err = enc.writeByteParam(X_MMS_PRIORITY, priority)
 			}
 		default:
 			if encodeTag == "optional" {
@@ -194,17 +213,18 @@ func (enc *MMSEncoder) writeAttachments(attachments []*Attachment) error {
 	return nil
 }
 
-func (enc *MMSEncoder) writeCharset(charset string) error {
-	if charset == "" {
-		return nil
+// encodeCharset returns the Well-known-charset encoding of charset as described in
+// section 8.4.2.8 of WAP-230-WSP-20010705-a, false is returned if charset is not in CHARSETS.
+func encodeCharset(charset string) ([]byte, bool) {
+	if charset == "*" {
+		return []byte{ANY_CHARSET}, true
 	}
-	charsetCode := uint64(ANY_CHARSET)
 	for k, v := range CHARSETS {
-		if v == charset {
-			charsetCode = k
+		if strings.EqualFold(v, charset) {
+			return encodeInteger(k), true
 		}
 	}
-	return enc.writeIntegerParam(WSP_PARAMETER_TYPE_CHARSET, charsetCode)
+	return nil, false
 }
 
 func (enc *MMSEncoder) writeLength(length uint64) error {
@@ -228,12 +248,23 @@ func encodeContentType(media string) (uint64, error) {
 	return 0, errors.New("cannot binary encode media")
 }
 
-func (enc *MMSEncoder) writeContentType(media, start, ctype, name string) error {
-	if start == "" && ctype == "" && name == "" {
+func (enc *MMSEncoder) writeContentType(media, start, ctype, name, charset string) error {
+	var encodedCharset []byte
+	if charset != "" {
+		var ok bool
+		if encodedCharset, ok = encodeCharset(charset); !ok {
+			log.Printf("Cannot encode charset %s for %s, skipping", charset, media)
+		}
+	}
+	if start == "" && ctype == "" && name == "" && encodedCharset == nil {
 		return enc.writeMediaType(media)
 	}
 
 	var contentType []byte
+	if encodedCharset != nil {
+		contentType = append(contentType, WSP_PARAMETER_TYPE_CHARSET|SHORT_FILTER)
+		contentType = append(contentType, encodedCharset...)
+	}
 	if start != "" {
 		contentType = append(contentType, WSP_PARAMETER_TYPE_START_DEFUNCT|SHORT_FILTER)
 		contentType = append(contentType, []byte(start)...)
@@ -283,16 +314,23 @@ func (enc *MMSEncoder) writeMediaType(media string) error {
 	return enc.writeString(media)
 }
 
-func (enc *MMSEncoder) writeRelativeExpiry(expiry uint64) error {
-	if err := enc.setParam(X_MMS_EXPIRY); err != nil {
+// writeTimeValueParam writes an X-Mms-Expiry or X-Mms-Delivery-Time header
+// with an absolute or relative value.
+func (enc *MMSEncoder) writeTimeValueParam(param byte, v TimeValue) error {
+	if err := enc.setParam(param); err != nil {
 		return err
 	}
-	encodedLong := encodeLong(expiry)
+	encodedLong := encodeLong(v.Seconds)
+
+	token := byte(ExpiryTokenRelative)
+	if v.Absolute {
+		token = ExpiryTokenAbsolute
+	}
 
 	var b []byte
 	// +1 for the token, +1 for the len of long
 	b = append(b, byte(len(encodedLong)+2))
-	b = append(b, ExpiryTokenRelative)
+	b = append(b, token)
 	b = append(b, byte(len(encodedLong)))
 	b = append(b, encodedLong...)
 
@@ -326,6 +364,53 @@ func (enc *MMSEncoder) writeQuotedStringParam(param byte, s string) error {
 	return enc.writeString(s)
 }
 
+// writeEncodedStringParam writes s as an Encoded-string-value as described in
+// section 7.2.9 of OMA-WAP-MMS-ENC-V1_1-20040715-A.
+//
+// US-ASCII strings are written as a plain Text-string, anything else is
+// written as a UTF-8 Text-string preceded by its length and charset.
+func (enc *MMSEncoder) writeEncodedStringParam(param byte, s string) error {
+	if s == "" {
+		enc.log = enc.log + "Skipping empty string\n"
+		return nil
+	}
+	if err := enc.setParam(param); err != nil {
+		return err
+	}
+	return enc.writeEncodedString(s)
+}
+
+func (enc *MMSEncoder) writeEncodedString(s string) error {
+	if isASCII(s) {
+		return enc.writeString(s)
+	}
+
+	charset, _ := encodeCharset("utf-8")
+	text := []byte(s)
+	if text[0]&0x80 != 0 {
+		// A Text-string starting with an octet >= 128 needs to be quoted.
+		text = append([]byte{TEXT_QUOTE}, text...)
+	}
+	text = append(text, 0)
+
+	if err := enc.writeLength(uint64(len(charset) + len(text))); err != nil {
+		return err
+	}
+	if err := enc.writeBytes(charset, len(charset)); err != nil {
+		return err
+	}
+	return enc.writeBytes(text, len(text))
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
 func (enc *MMSEncoder) writeStringParam(param byte, s string) error {
 	if s == "" {
 		enc.log = enc.log + "Skipping empty string\n"
@@ -354,6 +439,29 @@ func (enc *MMSEncoder) writeFrom() error {
 	return enc.writeByte(TOKEN_INSERT_ADDRESS)
 }
 
+// writeFromAddress writes a From-value with the Address-present-token for from,
+// or with the Insert-address-token if from is empty.
+func (enc *MMSEncoder) writeFromAddress(from string) error {
+	if from == "" {
+		return enc.writeFrom()
+	}
+	var address bytes.Buffer
+	if err := NewEncoder(&address).writeEncodedString(from); err != nil {
+		return err
+	}
+	if err := enc.setParam(FROM); err != nil {
+		return err
+	}
+	// +1 for the token
+	if err := enc.writeLength(uint64(address.Len() + 1)); err != nil {
+		return err
+	}
+	if err := enc.writeByte(TOKEN_ADDRESS_PRESENT); err != nil {
+		return err
+	}
+	return enc.writeBytes(address.Bytes(), address.Len())
+}
+
 func (enc *MMSEncoder) writeString(s string) error {
 	bytes := []byte(s)
 	bytes = append(bytes, 0)
@@ -416,6 +524,16 @@ func encodeLong(i uint64) (encodedLong []byte) {
 	return encodedLong
 }
 
+// encodeInteger returns the Integer-value encoding of i, a Short-integer
+// when i < 128 (=0x80) or a Long-integer otherwise.
+func encodeInteger(i uint64) []byte {
+	if i < 0x80 {
+		return []byte{byte(i | 0x80)}
+	}
+	encodedLong := encodeLong(i)
+	return append([]byte{byte(len(encodedLong))}, encodedLong...)
+}
+
 // writeInteger encodes i according to the Basic Rules described in section
 // 8.4.2.2 of WAP-230-WSP-20010705-a.
 //
@@ -25,7 +25,9 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	. "launchpad.net/gocheck"
 )
@@ -132,10 +134,92 @@ func (s *EncoderTestSuite) TestEncodeMSendReq(c *C) {
 	attachments := []*Attachment{att}
 
 	recipients := []string{"+12345"}
-	mSendReq := NewMSendReq(recipients, attachments, false)
+	mSendReq := NewMSendReq(recipients, attachments, false, false)
 
 	var outBytes bytes.Buffer
 	enc := NewEncoder(&outBytes)
 	err = enc.Encode(mSendReq)
 	c.Assert(err, IsNil)
 }
+
+func (s *EncoderTestSuite) TestEncodeMReadRecInd(c *C) {
+	expectedBytes := []byte{
+		//Message Type m-read-rec.ind
+		0x8C, 0x87,
+		// MMS Version 1.1
+		0x8D, 0x91,
+		// Message Id "abc"
+		0x8B, 0x61, 0x62, 0x63, 0x00,
+		// To "+12345/TYPE=PLMN"
+		0x97, 0x2B, 0x31, 0x32, 0x33, 0x34, 0x35, 0x2F, 0x54, 0x59, 0x50, 0x45, 0x3D, 0x50, 0x4C, 0x4D, 0x4E, 0x00,
+		// From insert address
+		0x89, 0x01, 0x81,
+		// Read Status read
+		0x9B, 0x80,
+	}
+	mReadRecInd := &MReadRecInd{
+		UUID:       "1",
+		Type:       TYPE_READ_REC_IND,
+		Version:    MMS_MESSAGE_VERSION_1_1,
+		MessageId:  "abc",
+		To:         []string{"+12345/TYPE=PLMN"},
+		ReadStatus: ReadStatusRead,
+	}
+	var outBytes bytes.Buffer
+	enc := NewEncoder(&outBytes)
+	c.Assert(enc.Encode(mReadRecInd), IsNil)
+	c.Assert(outBytes.Bytes(), DeepEquals, expectedBytes)
+}
+
+func (s *EncoderTestSuite) TestEncodeMAcknowledgeInd(c *C) {
+	expectedBytes := []byte{
+		//Message Type m-acknowledge.ind
+		0x8C, 0x85,
+		// Transaction Id
+		0x98, 0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x00,
+		// MMS Version 1.3
+		0x8D, 0x93,
+		// Report Allowed Yes
+		0x91, 0x80,
+	}
+	mRetrieveConf := &MRetrieveConf{
+		UUID:          "1",
+		TransactionId: "0123456",
+		Version:       MMS_MESSAGE_VERSION_1_3,
+	}
+	mAcknowledgeInd := mRetrieveConf.NewMAcknowledgeInd(true)
+	c.Check(mAcknowledgeInd.UUID, Equals, "1")
+	var outBytes bytes.Buffer
+	enc := NewEncoder(&outBytes)
+	c.Assert(enc.Encode(mAcknowledgeInd), IsNil)
+	c.Assert(outBytes.Bytes(), DeepEquals, expectedBytes)
+}
+
+func (s *EncoderTestSuite) TestEncodeTimeValues(c *C) {
+	expectedBytes := []byte{
+		// Expiry relative 1 day
+		0x88, 0x05, 0x81, 0x03, 0x01, 0x51, 0x80,
+		// Delivery Time absolute 2004-01-30 06:49:53 UTC
+		0x87, 0x06, 0x80, 0x04, 0x40, 0x19, 0xfe, 0x91,
+	}
+	expiry := RelativeTime(24 * time.Hour)
+	deliveryTime := AbsoluteTime(time.Unix(1075445393, 0))
+
+	var outBytes bytes.Buffer
+	enc := NewEncoder(&outBytes)
+	c.Assert(enc.writeTimeValueParam(X_MMS_EXPIRY, expiry), IsNil)
+	c.Assert(enc.writeTimeValueParam(X_MMS_DELIVERY_TIME, deliveryTime), IsNil)
+	c.Assert(outBytes.Bytes(), DeepEquals, expectedBytes)
+
+	dec := NewDecoder(outBytes.Bytes())
+	mSendReq := &MSendReq{}
+	reflectedPdu := reflect.ValueOf(mSendReq).Elem()
+	_, err := dec.ReadExpiry(&reflectedPdu, time.Time{})
+	c.Assert(err, IsNil)
+	c.Check(mSendReq.Expiry, Equals, expiry)
+	dec.Offset++
+	decoded, err := dec.readTimeValue()
+	c.Assert(err, IsNil)
+	c.Check(decoded, Equals, deliveryTime)
+	c.Check(dec.Offset, Equals, len(expectedBytes)-1)
+}
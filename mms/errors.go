@@ -10,6 +10,20 @@ func (e ErrorDecodeShortData) Error() string {
 	return fmt.Sprintf("expexted offset after decoding out of range [%d] with data length %d ", e.Expected, e.Length)
 }
 
+// ErrorDecodeHeader wraps the error that occurred while decoding the value of
+// the header starting at Offset.
+type ErrorDecodeHeader struct {
+	Header byte
+	Offset int
+	Err    error
+}
+
+func (e ErrorDecodeHeader) Error() string {
+	return fmt.Sprintf("Cannot decode header %#x @%d: %v", e.Header, e.Offset, e.Err)
+}
+
+func (e ErrorDecodeHeader) Unwrap() error { return e.Err }
+
 type ErrorDecodeUnknownExpiryToken uint64
 
 func (e ErrorDecodeUnknownExpiryToken) Error() string {
@@ -24,6 +38,22 @@ func (e ErrorDecodeInconsistentOffset) Error() string {
 	return fmt.Sprintf("Decoder offset after read [%d] is other than expected [%d]", e.Offset, e.Expected)
 }
 
+type ErrorUnsupportedCharset string
+
+func (e ErrorUnsupportedCharset) Error() string {
+	return fmt.Sprintf("Unsupported charset %q, falling back to UTF-8", string(e))
+}
+
+// ErrorMessageTooLarge is returned when a message can't be made to fit the
+// maximum message size of the carrier.
+type ErrorMessageTooLarge struct {
+	Size, MaxSize uint64
+}
+
+func (e ErrorMessageTooLarge) Error() string {
+	return fmt.Sprintf("Message size %d is over the maximum message size %d", e.Size, e.MaxSize)
+}
+
 const (
 	DebugErrorActivateContext      = "error-activate-context"
 	DebugErrorGetProxy             = "error-get-proxy"
@@ -0,0 +1,201 @@
+package mms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// JPEG markers defined in ITU T.81 table B.1
+const (
+	jpegMarkerSOI   = 0xD8
+	jpegMarkerEOI   = 0xD9
+	jpegMarkerSOS   = 0xDA
+	jpegMarkerTEM   = 0x01
+	jpegMarkerRST0  = 0xD0
+	jpegMarkerRST7  = 0xD7
+	jpegMarkerAPP1  = 0xE1
+	jpegMarkerAPP13 = 0xED
+)
+
+const exifTagOrientation = 0x0112
+
+var (
+	exifHeader   = []byte("Exif\x00\x00")
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// pngMetadataChunks are the PNG chunks that hold text, time or EXIF metadata.
+var pngMetadataChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// StripMetadata removes the EXIF, XMP and IPTC segments of JPEG attachments and
+// the metadata chunks of PNG attachments. The orientation of JPEG images is kept
+// so that they aren't shown rotated. Other attachments are left untouched.
+func (a *Attachment) StripMetadata() error {
+	var data []byte
+	var err error
+	switch baseMediaType(a.MediaType) {
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		data, err = stripJPEGMetadata(a.Data)
+	case "image/png":
+		data, err = stripPNGMetadata(a.Data)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	a.Data = data
+	return nil
+}
+
+// stripJPEGMetadata drops the APP1 (EXIF and XMP) and APP13 (IPTC) segments
+// preceding the image data.
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	stripped, orientation, err := splitJPEGMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	return withJPEGOrientation(stripped, orientation), nil
+}
+
+// splitJPEGMetadata returns data without the metadata segments, and the
+// orientation held in them.
+func splitJPEGMetadata(data []byte) (stripped []byte, orientation uint16, err error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
+		return nil, 0, errors.New("not a JPEG image")
+	}
+	var out bytes.Buffer
+	out.Write(data[:2])
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, 0, errors.New("JPEG segment does not start with a marker")
+		}
+		// Markers may be preceded by fill bytes.
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, 0, errors.New("truncated JPEG marker")
+		}
+		marker := data[i+1]
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			// The metadata segments precede the image data, which is kept as is.
+			out.Write(data[i:])
+			break
+		}
+		if marker == jpegMarkerTEM || (marker >= jpegMarkerRST0 && marker <= jpegMarkerRST7) {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, 0, errors.New("truncated JPEG segment length")
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, 0, errors.New("truncated JPEG segment")
+		}
+		switch marker {
+		case jpegMarkerAPP1:
+			// EXIF or XMP
+			if payload := data[i+4 : end]; bytes.HasPrefix(payload, exifHeader) {
+				orientation = exifOrientation(payload[len(exifHeader):])
+			}
+		case jpegMarkerAPP13:
+			// IPTC
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), orientation, nil
+}
+
+// exifOrientation returns the orientation tag of the first IFD of the TIFF
+// structure of an EXIF segment, or 0 if there is none.
+func exifOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := ifd + 2; e+12 <= len(tiff) && entries > 0; e, entries = e+12, entries-1 {
+		// Orientation is a single SHORT, of type 3.
+		if order.Uint16(tiff[e:]) == exifTagOrientation && order.Uint16(tiff[e+2:]) == 3 {
+			return order.Uint16(tiff[e+8:])
+		}
+	}
+	return 0
+}
+
+// withJPEGOrientation inserts an EXIF segment holding only orientation after
+// the start of image marker. Images without a rotation are returned as is.
+func withJPEGOrientation(data []byte, orientation uint16) []byte {
+	if orientation <= 1 || len(data) < 2 {
+		return data
+	}
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		// One IFD entry: Orientation, SHORT, count 1
+		0x00, 0x01,
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, byte(orientation >> 8), byte(orientation), 0x00, 0x00,
+		// No next IFD
+		0x00, 0x00, 0x00, 0x00,
+	}
+	length := 2 + len(exifHeader) + len(tiff)
+
+	out := make([]byte, 0, len(data)+2+length)
+	out = append(out, data[:2]...)
+	out = append(out, 0xFF, jpegMarkerAPP1, byte(length>>8), byte(length))
+	out = append(out, exifHeader...)
+	out = append(out, tiff...)
+	return append(out, data[2:]...)
+}
+
+// stripPNGMetadata drops the text, time and EXIF chunks.
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a PNG image")
+	}
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for i := len(pngSignature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, errors.New("truncated PNG chunk header")
+		}
+		// Length, type, data and CRC
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i+12 {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		chunkType := string(data[i+4 : i+8])
+		if !pngMetadataChunks[chunkType] {
+			out.Write(data[i:end])
+		}
+		i = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,153 @@
+package mms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// jpegSegment returns a JPEG segment with marker and payload.
+func jpegSegment(marker byte, payload []byte) []byte {
+	return append([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+}
+
+// pngChunk returns a PNG chunk of chunkType holding data.
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return append(chunk, 0, 0, 0, 0)
+}
+
+// newTaggedJPEG returns a JPEG photo with EXIF, XMP, IPTC and a comment.
+func newTaggedJPEG(t *testing.T, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, newNoiseImage(64, 48), nil); err != nil {
+		t.Fatal(err)
+	}
+	exif := append([]byte{}, exifHeader...)
+	exif = append(exif,
+		'I', 'I', 0x2A, 0x00, 0x08, 0x00, 0x00, 0x00,
+		// Two IFD entries, orientation and the offset to the GPS IFD
+		0x02, 0x00,
+		0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, byte(orientation), byte(orientation>>8), 0x00, 0x00,
+		0x25, 0x88, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, 0x26, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	)
+	exif = append(exif, "GPS 51.5007N 0.1246W, serial 0123456789"...)
+	xmp := []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta><exif:GPSLatitude>51,30.04N</exif:GPSLatitude></x:xmpmeta>")
+	iptc := []byte("Photoshop 3.0\x008BIM\x04\x04\x00\x00\x00\x00\x00\x10\x1c\x02\x5a\x00\x06London")
+
+	data := buf.Bytes()
+	tagged := append([]byte{}, data[:2]...)
+	tagged = append(tagged, jpegSegment(0xE1, exif)...)
+	tagged = append(tagged, jpegSegment(0xE1, xmp)...)
+	tagged = append(tagged, jpegSegment(0xED, iptc)...)
+	tagged = append(tagged, jpegSegment(0xFE, []byte("comment"))...)
+	return append(tagged, data[2:]...)
+}
+
+// newTaggedPNG returns a PNG image with text, time and EXIF chunks.
+func newTaggedPNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newNoiseImage(64, 48)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// Signature and IHDR
+	ihdrEnd := len(pngSignature) + 12 + 13
+	tagged := append([]byte{}, data[:ihdrEnd]...)
+	for _, chunk := range [][]byte{
+		pngChunk("tEXt", []byte("Comment\x00London")),
+		pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>")),
+		pngChunk("eXIf", []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x00")),
+		pngChunk("tIME", []byte{0x07, 0xE4, 1, 1, 0, 0, 0}),
+	} {
+		// Fix up the CRC, the PNG decoder checks it.
+		binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(chunk[4:len(chunk)-4]))
+		tagged = append(tagged, chunk...)
+	}
+	return append(tagged, data[ihdrEnd:]...)
+}
+
+func TestStripMetadata(t *testing.T) {
+	testCases := []struct {
+		name            string
+		mediaType       string
+		data            []byte
+		wantOrientation uint16
+		wantNot         []string
+		wantKept        []string
+	}{
+		{"jpeg", "image/jpeg", newTaggedJPEG(t, 1), 0, []string{"Exif", "GPS", "xmpmeta", "Photoshop"}, []string{"comment"}},
+		{"jpeg-rotated", "image/jpeg", newTaggedJPEG(t, 6), 6, []string{"GPS", "xmpmeta", "Photoshop"}, []string{"comment"}},
+		{"png", "image/png;charset=binary", newTaggedPNG(t), 0, []string{"tEXt", "iTXt", "eXIf", "tIME", "London"}, []string{"IHDR", "IDAT", "IEND"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := image.Decode(bytes.NewReader(tc.data)); err != nil {
+				t.Fatalf("Cannot decode test image: %v", err)
+			}
+			a := &Attachment{MediaType: tc.mediaType, Data: tc.data}
+			if err := a.StripMetadata(); err != nil {
+				t.Fatalf("StripMetadata = %v", err)
+			}
+
+			if _, _, err := image.Decode(bytes.NewReader(a.Data)); err != nil {
+				t.Errorf("Cannot decode stripped image: %v", err)
+			}
+			for _, s := range tc.wantNot {
+				if bytes.Contains(a.Data, []byte(s)) {
+					t.Errorf("Stripped image contains %q", s)
+				}
+			}
+			for _, s := range tc.wantKept {
+				if !bytes.Contains(a.Data, []byte(s)) {
+					t.Errorf("Stripped image lost %q", s)
+				}
+			}
+			if tc.mediaType == "image/jpeg" {
+				if _, orientation, _ := splitJPEGMetadata(a.Data); orientation != tc.wantOrientation {
+					t.Errorf("Stripped image orientation = %d, want %d", orientation, tc.wantOrientation)
+				}
+			}
+		})
+	}
+}
+
+func TestStripMetadataErrors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mediaType string
+		data      []byte
+	}{
+		{"jpeg-not-jpeg", "image/jpeg", []byte("GIF89a")},
+		{"jpeg-truncated-segment", "image/jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x10, 'E', 'x'}},
+		{"jpeg-no-marker", "image/jpeg", []byte{0xFF, 0xD8, 0x00}},
+		{"png-not-png", "image/png", []byte{0xFF, 0xD8}},
+		{"png-truncated-chunk", "image/png", append(append([]byte{}, pngSignature...), 0xFF, 0xFF, 0xFF, 0xFF, 't', 'E', 'X', 't')},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &Attachment{MediaType: tc.mediaType, Data: tc.data}
+			if err := a.StripMetadata(); err == nil {
+				t.Errorf("StripMetadata = nil, want an error")
+			}
+			if !bytes.Equal(a.Data, tc.data) {
+				t.Errorf("StripMetadata changed the data on error")
+			}
+		})
+	}
+
+	text := &Attachment{MediaType: "text/plain", Data: []byte("Exif")}
+	if err := text.StripMetadata(); err != nil || string(text.Data) != "Exif" {
+		t.Errorf("StripMetadata of text = %v, %q", err, text.Data)
+	}
+}
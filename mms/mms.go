@@ -22,6 +22,7 @@
 package mms
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -83,6 +84,8 @@ const (
 	TYPE_RETRIEVE_CONF    = 0x84
 	TYPE_ACKNOWLEDGE_IND  = 0x85
 	TYPE_DELIVERY_IND     = 0x86
+	TYPE_READ_REC_IND     = 0x87
+	TYPE_READ_ORIG_IND    = 0x88
 )
 
 const (
@@ -104,6 +107,51 @@ const (
 	ExpiryTokenRelative byte = 129
 )
 
+// TimeValue holds the value of the X-Mms-Expiry, X-Mms-Delivery-Time and
+// X-Mms-Reply-Charging-Deadline headers defined in OMA-WAP-MMS sections 7.2.10
+// and 7.2.12, which is either a date or a number of seconds relative to the time
+// the MMS Proxy-Relay gets the message.
+type TimeValue struct {
+	Absolute bool
+	// Seconds since 1970-01-01 00:00:00 UTC if Absolute, else seconds from
+	// the time the message is received by the MMS Proxy-Relay.
+	Seconds uint64
+}
+
+// AbsoluteTime returns the TimeValue for t.
+func AbsoluteTime(t time.Time) TimeValue {
+	return TimeValue{Absolute: true, Seconds: uint64(t.Unix())}
+}
+
+// RelativeTime returns the TimeValue d after the message is received by the MMS Proxy-Relay.
+func RelativeTime(d time.Duration) TimeValue {
+	return TimeValue{Seconds: uint64(d.Seconds())}
+}
+
+// IsZero returns true if there is no time value.
+func (tv TimeValue) IsZero() bool {
+	return tv.Seconds == 0
+}
+
+// UnmarshalJSON decodes tv from json. Messages stored before the X-Mms-Reply-Charging-Deadline
+// was decoded as a TimeValue hold a number instead, which is decoded as no time value.
+func (tv *TimeValue) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] != '{' {
+		*tv = TimeValue{}
+		return nil
+	}
+	type timeValue TimeValue
+	return json.Unmarshal(data, (*timeValue)(tv))
+}
+
+// Time returns the time for tv if the message is received at received.
+func (tv TimeValue) Time(received time.Time) time.Time {
+	if tv.Absolute {
+		return time.Unix(int64(tv.Seconds), 0)
+	}
+	return received.Add(time.Duration(tv.Seconds) * time.Second)
+}
+
 // From tokens defined in OMA-WAP-MMS section 7.2.11
 const (
 	TOKEN_ADDRESS_PRESENT = 0x80
@@ -118,12 +166,25 @@ const (
 	ClassAuto          byte = 131
 )
 
+// Priorities defined in OMA-WAP-MMS section 7.2.17
+const (
+	PriorityLow    byte = 128
+	PriorityNormal byte = 129
+	PriorityHigh   byte = 130
+)
+
 // Report Report defined in OMA-WAP-MMS 7.2.20
 const (
 	ReadReportYes byte = 128
 	ReadReportNo  byte = 129
 )
 
+// Read Status defined in OMA-WAP-MMS section 7.2.22
+const (
+	ReadStatusRead               byte = 128
+	ReadStatusDeletedWithoutRead byte = 129
+)
+
 // Report Allowed defined in OMA-WAP-MMS section 7.2.26
 const (
 	ReportAllowedYes byte = 128
@@ -175,11 +236,14 @@ const (
 
 // Status defined in OMA-WAP-MMS section 7.2.23
 const (
-	STATUS_EXPIRED      = 128
-	STATUS_RETRIEVED    = 129
-	STATUS_REJECTED     = 130
-	STATUS_DEFERRED     = 131
-	STATUS_UNRECOGNIZED = 132
+	STATUS_EXPIRED       = 128
+	STATUS_RETRIEVED     = 129
+	STATUS_REJECTED      = 130
+	STATUS_DEFERRED      = 131
+	STATUS_UNRECOGNIZED  = 132
+	STATUS_INDETERMINATE = 133
+	STATUS_FORWARDED     = 134
+	STATUS_UNREACHABLE   = 135
 )
 
 // MSendReq holds a m-send.req message defined in
@@ -192,18 +256,18 @@ type MSendReq struct {
 	Date             uint64 `encode:"optional"`
 	From             string
 	To               []string
-	Cc               string `encode:"no"`
-	Bcc              string `encode:"no"`
-	Subject          string `encode:"optional"`
-	Class            byte   `encode:"optional"`
-	Expiry           uint64 `encode:"optional"`
-	DeliveryTime     uint64 `encode:"optional"`
-	Priority         byte   `encode:"optional"`
-	SenderVisibility byte   `encode:"optional"`
-	DeliveryReport   byte   `encode:"optional"`
-	ReadReport       byte   `encode:"optional"`
-	ContentTypeStart string `encode:"no"`
-	ContentTypeType  string `encode:"no"`
+	Cc               []string  `encode:"optional"`
+	Bcc              []string  `encode:"optional"`
+	Subject          string    `encode:"optional"`
+	Class            byte      `encode:"optional"`
+	Expiry           TimeValue `encode:"optional"`
+	DeliveryTime     TimeValue `encode:"optional"`
+	Priority         byte      `encode:"optional"`
+	SenderVisibility byte      `encode:"optional"`
+	DeliveryReport   byte      `encode:"optional"`
+	ReadReport       byte      `encode:"optional"`
+	ContentTypeStart string    `encode:"no"`
+	ContentTypeType  string    `encode:"no"`
 	ContentType      string
 	Attachments      []*Attachment `encode:"no"`
 }
@@ -227,13 +291,15 @@ type MNotificationInd struct {
 	RedownloadOfUUID                     string // If not empty, it means that the struct was created to redownload a previously failed message download with UUID stored in field.
 	Received                             time.Time
 	Type, Version, Class, DeliveryReport byte
-	ReplyCharging, ReplyChargingDeadline byte
+	ReplyCharging                        byte
+	ReplyChargingDeadline                TimeValue
 	Priority                             byte
 	ReplyChargingId                      string
 	TransactionId, ContentLocation       string
 	From, Subject                        string
 	Expiry                               time.Time
 	Size                                 uint64
+	Deferred                             bool // If true, the retrieval was deferred by a m-notifyresp.ind with deferred status and has to be acknowledged by m-acknowledge.ind.
 }
 
 // MNotifyRespInd holds a m-notifyresp.ind message defined in
@@ -247,18 +313,29 @@ type MNotifyRespInd struct {
 	ReportAllowed byte `encode:"optional"`
 }
 
+// MAcknowledgeInd holds a m-acknowledge.ind message defined in
+// OMA-WAP-MMS-ENC-v1.1 section 6.4
+type MAcknowledgeInd struct {
+	UUID          string `encode:"no"`
+	Type          byte
+	TransactionId string
+	Version       byte
+	ReportAllowed byte `encode:"optional"`
+}
+
 // MRetrieveConf holds a m-retrieve.conf message defined in
 // OMA-WAP-MMS-ENC-v1.1 section 6.3
 type MRetrieveConf struct {
 	MMSReader
 	UUID                                       string
 	Type, Version, Status, Class, Priority     byte
-	ReplyCharging, ReplyChargingDeadline       byte
+	ReplyCharging                              byte
+	ReplyChargingDeadline                      TimeValue
 	ReplyChargingId                            string
 	ReadReport, RetrieveStatus, DeliveryReport byte
 	TransactionId, MessageId, RetrieveText     string
-	From, Cc, Subject                          string
-	To                                         []string
+	From, Subject                              string
+	To, Cc                                     []string
 	ReportAllowed                              byte
 	Date                                       uint64
 	Content                                    Attachment
@@ -266,13 +343,46 @@ type MRetrieveConf struct {
 	Data                                       []byte
 }
 
+// MDeliveryInd holds a m-delivery.ind message defined in
+// OMA-WAP-MMS-ENC-v1.1 section 6.8
+type MDeliveryInd struct {
+	MMSReader
+	Type, Version, Status byte
+	MessageId             string
+	To                    []string
+	Date                  uint64
+}
+
+// MReadRecInd holds a m-read-rec.ind message defined in
+// OMA-WAP-MMS-ENC-v1.1 section 6.7.1
+type MReadRecInd struct {
+	UUID       string `encode:"no"`
+	Type       byte
+	Version    byte
+	MessageId  string
+	To         []string
+	From       string
+	Date       uint64 `encode:"optional"`
+	ReadStatus byte
+}
+
+// MReadOrigInd holds a m-read-orig.ind message defined in
+// OMA-WAP-MMS-ENC-v1.1 section 6.7.2
+type MReadOrigInd struct {
+	MMSReader
+	Type, Version, ReadStatus byte
+	MessageId, From           string
+	To                        []string
+	Date                      uint64
+}
+
 type MMSReader interface{}
 type MMSWriter interface{}
 
-// NewMSendReq creates a personal message with a normal priority and no read report
-func NewMSendReq(recipients []string, attachments []*Attachment, deliveryReport bool) *MSendReq {
+// NewMSendReq creates a personal message with a normal priority
+func NewMSendReq(recipients []string, attachments []*Attachment, deliveryReport, readReport bool) *MSendReq {
 	for i := range recipients {
-		recipients[i] += "/TYPE=PLMN"
+		recipients[i] = NewAddress(recipients[i]).Encode()
 	}
 	uuid := GenUUID()
 
@@ -286,9 +396,9 @@ func NewMSendReq(recipients []string, attachments []*Attachment, deliveryReport
 		UUID:          uuid,
 		Date:          getDate(),
 		// this will expire the message in 7 days
-		Expiry:           uint64(time.Duration(time.Hour * 24 * 7).Seconds()),
+		Expiry:           RelativeTime(time.Hour * 24 * 7),
 		DeliveryReport:   getDeliveryReport(deliveryReport),
-		ReadReport:       ReadReportNo,
+		ReadReport:       getReadReport(readReport),
 		Class:            ClassPersonal,
 		ContentType:      "application/vnd.wap.multipart.related",
 		ContentTypeStart: smilStart,
@@ -297,6 +407,24 @@ func NewMSendReq(recipients []string, attachments []*Attachment, deliveryReport
 	}
 }
 
+// AddCc adds the recipients as Cc recipients of the message.
+func (mSendReq *MSendReq) AddCc(recipients ...string) {
+	mSendReq.Cc = append(mSendReq.Cc, EncodeAddresses(recipients)...)
+}
+
+// AddBcc adds the recipients as Bcc recipients of the message.
+func (mSendReq *MSendReq) AddBcc(recipients ...string) {
+	mSendReq.Bcc = append(mSendReq.Bcc, EncodeAddresses(recipients)...)
+}
+
+// Recipients returns the To, Cc and Bcc recipients of the message.
+func (mSendReq *MSendReq) Recipients() []string {
+	recipients := make([]string, 0, len(mSendReq.To)+len(mSendReq.Cc)+len(mSendReq.Bcc))
+	recipients = append(recipients, mSendReq.To...)
+	recipients = append(recipients, mSendReq.Cc...)
+	return append(recipients, mSendReq.Bcc...)
+}
+
 func NewMSendConf() *MSendConf {
 	return &MSendConf{
 		Type: TYPE_SEND_CONF,
@@ -411,10 +539,54 @@ func (mRetrieveConf *MRetrieveConf) NewMNotifyRespInd(deliveryReport bool) *MNot
 	}
 }
 
+// NewMAcknowledgeInd creates a m-acknowledge.ind confirming the retrieval
+// of a previously deferred message.
+func (mRetrieveConf *MRetrieveConf) NewMAcknowledgeInd(deliveryReport bool) *MAcknowledgeInd {
+	return &MAcknowledgeInd{
+		Type:          TYPE_ACKNOWLEDGE_IND,
+		UUID:          mRetrieveConf.UUID,
+		TransactionId: mRetrieveConf.TransactionId,
+		Version:       mRetrieveConf.Version,
+		ReportAllowed: getReportAllowed(deliveryReport),
+	}
+}
+
+// NewMReadRecInd creates a m-read-rec.ind reporting to the originator of the
+// retrieved message, that the message was read.
+func (mRetrieveConf *MRetrieveConf) NewMReadRecInd() *MReadRecInd {
+	return &MReadRecInd{
+		Type:       TYPE_READ_REC_IND,
+		UUID:       mRetrieveConf.UUID,
+		Version:    MMS_MESSAGE_VERSION_1_1,
+		MessageId:  mRetrieveConf.MessageId,
+		To:         []string{mRetrieveConf.From},
+		Date:       getDate(),
+		ReadStatus: ReadStatusRead,
+	}
+}
+
+// ReadReportRequested returns true if the originator of the retrieved message
+// requested a read report.
+func (mRetrieveConf *MRetrieveConf) ReadReportRequested() bool {
+	return mRetrieveConf.ReadReport == ReadReportYes && mRetrieveConf.MessageId != "" && mRetrieveConf.From != ""
+}
+
 func NewMNotifyRespInd() *MNotifyRespInd {
 	return &MNotifyRespInd{Type: TYPE_NOTIFYRESP_IND}
 }
 
+func NewMAcknowledgeInd() *MAcknowledgeInd {
+	return &MAcknowledgeInd{Type: TYPE_ACKNOWLEDGE_IND}
+}
+
+func NewMDeliveryInd() *MDeliveryInd {
+	return &MDeliveryInd{Type: TYPE_DELIVERY_IND}
+}
+
+func NewMReadOrigInd() *MReadOrigInd {
+	return &MReadOrigInd{Type: TYPE_READ_ORIG_IND}
+}
+
 func NewMRetrieveConf(uuid string) *MRetrieveConf {
 	return &MRetrieveConf{Type: TYPE_RETRIEVE_CONF, UUID: uuid}
 }
@@ -436,6 +608,12 @@ func GenUUID() string {
 var ErrTransient = errors.New("Error-transient-failure")
 var ErrPermanent = errors.New("Error-permament-failure")
 
+// ErrCancelled is returned when a transfer is cancelled.
+var ErrCancelled = errors.New("transfer cancelled")
+
+// ErrUploadTimeout is returned when the message center doesn't answer an upload in time.
+var ErrUploadTimeout = errors.New("upload timeout")
+
 func (mSendConf *MSendConf) Status() error {
 	s := mSendConf.ResponseStatus
 	// these are case by case Response Status and we need to determine each one
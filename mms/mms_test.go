@@ -37,10 +37,52 @@ var _ = Suite(&MMSTestSuite{})
 func (s *MMSTestSuite) TestNewMSendReq(c *C) {
 	recipients := []string{"+11111", "+22222", "+33333"}
 	expectedRecipients := []string{"+11111/TYPE=PLMN", "+22222/TYPE=PLMN", "+33333/TYPE=PLMN"}
-	mSendReq := NewMSendReq(recipients, []*Attachment{}, false)
+	mSendReq := NewMSendReq(recipients, []*Attachment{}, false, false)
 	c.Check(mSendReq.To, DeepEquals, expectedRecipients)
 	c.Check(mSendReq.ContentType, Equals, "application/vnd.wap.multipart.related")
 	c.Check(mSendReq.Type, Equals, byte(TYPE_SEND_REQ))
+	c.Check(mSendReq.ReadReport, Equals, ReadReportNo)
+}
+
+func (s *MMSTestSuite) TestMSendReqRecipients(c *C) {
+	mSendReq := NewMSendReq([]string{"+11111"}, []*Attachment{}, false, false)
+	mSendReq.AddCc("+22222", "+33333")
+	mSendReq.AddBcc("+44444")
+	c.Check(mSendReq.Cc, DeepEquals, []string{"+22222/TYPE=PLMN", "+33333/TYPE=PLMN"})
+	c.Check(mSendReq.Bcc, DeepEquals, []string{"+44444/TYPE=PLMN"})
+	c.Check(mSendReq.Recipients(), DeepEquals, []string{
+		"+11111/TYPE=PLMN", "+22222/TYPE=PLMN", "+33333/TYPE=PLMN", "+44444/TYPE=PLMN",
+	})
+}
+
+func (s *MMSTestSuite) TestNewMSendReqAddressTypes(c *C) {
+	recipients := []string{"+11111", "user@example.com", "2222"}
+	mSendReq := NewMSendReq(recipients, []*Attachment{}, false, false)
+	c.Check(mSendReq.To, DeepEquals, []string{"+11111/TYPE=PLMN", "user@example.com", "2222/TYPE=PLMN"})
+}
+
+func (s *MMSTestSuite) TestNewMSendReqWithReadReport(c *C) {
+	mSendReq := NewMSendReq([]string{"+11111"}, []*Attachment{}, false, true)
+	c.Check(mSendReq.ReadReport, Equals, ReadReportYes)
+}
+
+func (s *MMSTestSuite) TestNewMReadRecInd(c *C) {
+	mRetrieveConf := &MRetrieveConf{
+		UUID:       "1",
+		MessageId:  "abc",
+		From:       "+11111/TYPE=PLMN",
+		ReadReport: ReadReportYes,
+	}
+	c.Assert(mRetrieveConf.ReadReportRequested(), Equals, true)
+	mReadRecInd := mRetrieveConf.NewMReadRecInd()
+	c.Check(mReadRecInd.Type, Equals, byte(TYPE_READ_REC_IND))
+	c.Check(mReadRecInd.UUID, Equals, "1")
+	c.Check(mReadRecInd.MessageId, Equals, "abc")
+	c.Check(mReadRecInd.To, DeepEquals, []string{"+11111/TYPE=PLMN"})
+	c.Check(mReadRecInd.ReadStatus, Equals, ReadStatusRead)
+
+	mRetrieveConf.ReadReport = ReadReportNo
+	c.Check(mRetrieveConf.ReadReportRequested(), Equals, false)
 }
 
 func TestMNotificationInd_Expire(t *testing.T) {
@@ -229,3 +271,21 @@ func TestMNotificationInd_PopDebugError(t *testing.T) {
 		})
 	}
 }
+
+func (s *MMSTestSuite) TestGetSmilFromStart(c *C) {
+	mRetrieveConf := &MRetrieveConf{
+		Content: Attachment{MediaType: "application/vnd.wap.multipart.related", Start: "<smil>"},
+		Attachments: []Attachment{
+			{MediaType: "application/smil", ContentId: "<other>", Data: []byte("other")},
+			{MediaType: "text/plain;charset=utf-8", FileName: "text.txt", Data: []byte("text")},
+			{MediaType: "application/smil;charset=utf-8", ContentId: "<smil>", Data: []byte("smil")},
+		},
+	}
+	smil, err := mRetrieveConf.GetSmil()
+	c.Assert(err, IsNil)
+	c.Check(smil, Equals, "smil")
+
+	dataParts := mRetrieveConf.GetDataParts()
+	c.Assert(dataParts, HasLen, 1)
+	c.Check(dataParts[0].PartName(), Equals, "text.txt")
+}
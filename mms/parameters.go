@@ -66,6 +66,7 @@ const (
 	SHORT_LENGTH_MAX = 30
 	LENGTH_QUOTE     = 31
 	STRING_QUOTE     = 34
+	TEXT_QUOTE       = 127
 	SHORT_FILTER     = 0x80
 )
 
@@ -137,7 +138,15 @@ var CONTENT_TYPES []string = []string{
 
 var CHARSETS map[uint64]string = map[uint64]string{
 	0x07EA: "big5",
+	0x07E9: "gb2312",
+	0x71:   "gbk",
 	0x03E8: "iso-10646-ucs-2",
+	0x03F7: "utf-16",
+	0x03F5: "utf-16be",
+	0x03F6: "utf-16le",
+	0x26:   "euc-kr",
+	0x27:   "iso-2022-jp",
+	0x12:   "euc-jp",
 	0x04:   "iso-8859-1",
 	0x05:   "iso-8859-2",
 	0x06:   "iso-8859-3",
@@ -150,4 +159,8 @@ var CHARSETS map[uint64]string = map[uint64]string{
 	0x11:   "shift_JIS",
 	0x03:   "us-ascii",
 	0x6A:   "utf-8",
+	0x08CA: "windows-1250",
+	0x08CB: "windows-1251",
+	0x08CC: "windows-1252",
+	0x0824: "koi8-r",
 }
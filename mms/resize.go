@@ -0,0 +1,306 @@
+package mms
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"math"
+	"strings"
+)
+
+const (
+	// minImageSide is the length of the longest side of an image under which
+	// it isn't downscaled any further.
+	minImageSide = 160
+	// minJPEGQuality is the quality under which JPEG images aren't re-encoded.
+	minJPEGQuality = 40
+	// downscaleStep is the factor the image sides are scaled down with on
+	// each attempt to fit a message.
+	downscaleStep = 0.8
+)
+
+// EncodedSize returns the size of the encoded m-send.req.
+func (pdu *MSendReq) EncodedSize() (uint64, error) {
+	var w countWriter
+	if err := NewEncoder(&w).Encode(pdu); err != nil {
+		return 0, err
+	}
+	return uint64(w), nil
+}
+
+// FitSize re-encodes the JPEG, PNG and GIF attachments at a lower resolution
+// or quality until the encoded m-send.req is at most maxSize bytes. A maxSize
+// of 0 means there is no limit. ErrorMessageTooLarge is returned if the
+// message can't be made to fit.
+func (pdu *MSendReq) FitSize(maxSize uint64) error {
+	if maxSize == 0 {
+		return nil
+	}
+	size, err := pdu.EncodedSize()
+	if err != nil || size <= maxSize {
+		return err
+	}
+
+	var images []*scalableImage
+	for _, a := range pdu.Attachments {
+		img, err := newScalableImage(a)
+		if err != nil {
+			log.Printf("Cannot downscale attachment %s: %v", a.ContentLocation, err)
+			continue
+		}
+		if img != nil {
+			images = append(images, img)
+		}
+	}
+
+	// The encoded size of an image is roughly proportional to its area.
+	scale := math.Sqrt(float64(maxSize) / float64(size))
+	quality := jpeg.DefaultQuality
+	for len(images) > 0 {
+		exhausted := quality <= minJPEGQuality
+		for _, img := range images {
+			if err := img.resize(scale, quality); err != nil {
+				return err
+			}
+			if !img.isMinimal(scale) {
+				exhausted = false
+			}
+		}
+		if size, err = pdu.EncodedSize(); err != nil || size <= maxSize {
+			return err
+		}
+		log.Printf("Message is %d bytes at %.2f scale and quality %d, the maximum is %d", size, scale, quality, maxSize)
+		if exhausted {
+			break
+		}
+		scale *= downscaleStep
+		if quality > minJPEGQuality {
+			quality -= 10
+		}
+	}
+	return ErrorMessageTooLarge{size, maxSize}
+}
+
+type countWriter uint64
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	*w += countWriter(len(p))
+	return len(p), nil
+}
+
+// scalableImage holds an image attachment decoded once to be re-encoded at
+// different scales.
+type scalableImage struct {
+	attachment *Attachment
+	data       []byte
+	image      image.Image
+	gif        *gif.GIF
+	longest    int
+	// scaled is the image scaled by the previous resize, later resizes to a
+	// lower scale start from it instead of the original.
+	scaled image.Image
+	// orientation of JPEG images, kept as re-encoding drops their metadata.
+	orientation uint16
+}
+
+// newScalableImage decodes a JPEG, PNG or GIF attachment, it returns nil for
+// any other attachment.
+func newScalableImage(a *Attachment) (*scalableImage, error) {
+	img := &scalableImage{attachment: a, data: a.Data}
+	var err error
+	switch baseMediaType(a.MediaType) {
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		if img.image, err = jpeg.Decode(bytes.NewReader(a.Data)); err == nil {
+			_, img.orientation, _ = splitJPEGMetadata(a.Data)
+		}
+	case "image/png":
+		img.image, err = png.Decode(bytes.NewReader(a.Data))
+	case "image/gif":
+		img.gif, err = gif.DecodeAll(bytes.NewReader(a.Data))
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bounds image.Rectangle
+	if img.gif != nil {
+		bounds = image.Rect(0, 0, img.gif.Config.Width, img.gif.Config.Height)
+	} else {
+		bounds = img.image.Bounds()
+	}
+	img.longest = bounds.Dx()
+	if bounds.Dy() > img.longest {
+		img.longest = bounds.Dy()
+	}
+	return img, nil
+}
+
+// isMinimal returns true if the image isn't scaled down any further than scale.
+func (img *scalableImage) isMinimal(scale float64) bool {
+	return float64(img.longest)*scale <= minImageSide
+}
+
+// resize re-encodes the attachment from the original image scaled by scale,
+// JPEG images are encoded with quality. The attachment is only replaced if it
+// becomes smaller.
+func (img *scalableImage) resize(scale float64, quality int) error {
+	if scale > 1 {
+		scale = 1
+	}
+	if img.isMinimal(scale) {
+		scale = math.Min(1, float64(minImageSide)/float64(img.longest))
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if img.gif != nil {
+		err = gif.EncodeAll(&buf, scaleGIF(img.gif, scale))
+	} else {
+		scaled := img.scaleImage(scale)
+		if strings.Contains(img.attachment.MediaType, "png") {
+			encoder := png.Encoder{CompressionLevel: png.BestCompression}
+			err = encoder.Encode(&buf, scaled)
+		} else {
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: quality})
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	data := buf.Bytes()
+	if img.orientation != 0 {
+		data = withJPEGOrientation(data, img.orientation)
+	}
+	if len(data) < len(img.data) {
+		img.attachment.Data = data
+	} else {
+		img.attachment.Data = img.data
+	}
+	return nil
+}
+
+// scaleImage returns the original image scaled by scale. It is scaled from the
+// result of the previous call, if that is at least as large.
+func (img *scalableImage) scaleImage(scale float64) image.Image {
+	ob := img.image.Bounds()
+	width, height := scaledSide(ob.Dx(), scale), scaledSide(ob.Dy(), scale)
+	src := img.image
+	if img.scaled != nil {
+		if sb := img.scaled.Bounds(); sb.Dx() >= width && sb.Dy() >= height {
+			src = img.scaled
+		}
+	}
+	img.scaled = scaleImage(src, width, height)
+	return img.scaled
+}
+
+// scaleImage scales src to width and height averaging the source pixels
+// covered by each destination pixel.
+func scaleImage(src image.Image, width, height int) image.Image {
+	sb := src.Bounds()
+	if width == sb.Dx() && height == sb.Dy() {
+		return src
+	}
+	switch src := src.(type) {
+	case *image.RGBA:
+		return scaleRGBA(src, width, height)
+	case *image.YCbCr:
+		return scaleYCbCr(src, width, height)
+	default:
+		// Converted once, to access the pixels directly.
+		rgba := image.NewRGBA(sb)
+		draw.Draw(rgba, sb, src, sb.Min, draw.Src)
+		return scaleRGBA(rgba, width, height)
+	}
+}
+
+// boxes calls average for each destination pixel of a width by height image
+// with the source rectangle it covers in sb.
+func boxes(sb image.Rectangle, width, height int, average func(x, y int, box image.Rectangle)) {
+	for y := 0; y < height; y++ {
+		y0, y1 := sb.Min.Y+y*sb.Dy()/height, sb.Min.Y+(y+1)*sb.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := sb.Min.X+x*sb.Dx()/width, sb.Min.X+(x+1)*sb.Dx()/width
+			average(x, y, image.Rect(x0, y0, x1, y1))
+		}
+	}
+}
+
+func scaleRGBA(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	boxes(src.Bounds(), width, height, func(x, y int, box image.Rectangle) {
+		var r, g, b, a uint64
+		for sy := box.Min.Y; sy < box.Max.Y; sy++ {
+			pix := src.Pix[src.PixOffset(box.Min.X, sy):src.PixOffset(box.Max.X, sy)]
+			for i := 0; i < len(pix); i += 4 {
+				r, g, b, a = r+uint64(pix[i]), g+uint64(pix[i+1]), b+uint64(pix[i+2]), a+uint64(pix[i+3])
+			}
+		}
+		n := uint64(box.Dx() * box.Dy())
+		i := dst.PixOffset(x, y)
+		dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+	})
+	return dst
+}
+
+func scaleYCbCr(src *image.YCbCr, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	boxes(src.Bounds(), width, height, func(x, y int, box image.Rectangle) {
+		var r, g, b uint64
+		for sy := box.Min.Y; sy < box.Max.Y; sy++ {
+			for sx := box.Min.X; sx < box.Max.X; sx++ {
+				ci := src.COffset(sx, sy)
+				cr, cg, cb := color.YCbCrToRGB(src.Y[src.YOffset(sx, sy)], src.Cb[ci], src.Cr[ci])
+				r, g, b = r+uint64(cr), g+uint64(cg), b+uint64(cb)
+			}
+		}
+		n := uint64(box.Dx() * box.Dy())
+		i := dst.PixOffset(x, y)
+		dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), 0xff
+	})
+	return dst
+}
+
+// scaleGIF scales all the frames of src by scale keeping their palettes.
+func scaleGIF(src *gif.GIF, scale float64) *gif.GIF {
+	dst := *src
+	dst.Config.Width = scaledSide(src.Config.Width, scale)
+	dst.Config.Height = scaledSide(src.Config.Height, scale)
+	if dst.Config.Width == src.Config.Width && dst.Config.Height == src.Config.Height {
+		return src
+	}
+
+	dst.Image = make([]*image.Paletted, len(src.Image))
+	for i, frame := range src.Image {
+		fb := frame.Bounds()
+		r := image.Rect(
+			int(float64(fb.Min.X)*scale), int(float64(fb.Min.Y)*scale),
+			int(float64(fb.Min.X)*scale)+scaledSide(fb.Dx(), scale), int(float64(fb.Min.Y)*scale)+scaledSide(fb.Dy(), scale),
+		)
+		scaled := image.NewPaletted(r, frame.Palette)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			sy := fb.Min.Y + (y-r.Min.Y)*fb.Dy()/r.Dy()
+			for x := r.Min.X; x < r.Max.X; x++ {
+				sx := fb.Min.X + (x-r.Min.X)*fb.Dx()/r.Dx()
+				scaled.SetColorIndex(x, y, frame.ColorIndexAt(sx, sy))
+			}
+		}
+		dst.Image[i] = scaled
+	}
+	return &dst
+}
+
+func scaledSide(side int, scale float64) int {
+	if scaled := int(float64(side) * scale); scaled > 0 {
+		return scaled
+	}
+	return 1
+}
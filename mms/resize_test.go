@@ -0,0 +1,154 @@
+package mms
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+)
+
+func newNoiseImage(w, h int) *image.RGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(rnd.Intn(256)), uint8(x), uint8(y), 255})
+		}
+	}
+	return img
+}
+
+func newImageAttachment(t *testing.T, mediaType string, w, h int) *Attachment {
+	var buf bytes.Buffer
+	var err error
+	img := newNoiseImage(w, h)
+	switch mediaType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	case "image/gif":
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		for i := range frame.Pix {
+			frame.Pix[i] = img.Pix[i*4]
+		}
+		err = gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}})
+	}
+	if err != nil {
+		t.Fatalf("Cannot encode %s: %v", mediaType, err)
+	}
+	return &Attachment{MediaType: mediaType, ContentId: "<" + mediaType + ">", ContentLocation: mediaType, Data: buf.Bytes()}
+}
+
+func TestFitSize(t *testing.T) {
+	testCases := []struct {
+		mediaType string
+		maxSize   uint64
+	}{
+		{"image/jpeg", 100 * 1024},
+		{"image/png", 100 * 1024},
+		{"image/gif", 100 * 1024},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mediaType, func(t *testing.T) {
+			a := newImageAttachment(t, tc.mediaType, 800, 600)
+			pdu := &MSendReq{Type: TYPE_SEND_REQ, To: []string{"+12345/TYPE=PLMN"}, ContentType: "application/vnd.wap.multipart.related", Attachments: []*Attachment{a}}
+			if size, _ := pdu.EncodedSize(); size <= tc.maxSize {
+				t.Fatalf("Test message of %d bytes already fits in %d", size, tc.maxSize)
+			}
+
+			if err := pdu.FitSize(tc.maxSize); err != nil {
+				t.Fatalf("FitSize(%d) = %v, want nil", tc.maxSize, err)
+			}
+			if size, _ := pdu.EncodedSize(); size > tc.maxSize {
+				t.Errorf("FitSize(%d) encoded size = %d", tc.maxSize, size)
+			}
+			config, format, err := image.DecodeConfig(bytes.NewReader(a.Data))
+			if err != nil {
+				t.Fatalf("Cannot decode the downscaled image: %v", err)
+			}
+			// Keep the 4:3 aspect ratio give or take a pixel.
+			ratio := config.Width*3 - config.Height*4
+			if "image/"+format != tc.mediaType || config.Width >= 800 || config.Height >= 600 || ratio < -4 || ratio > 4 {
+				t.Errorf("Downscaled image is a %dx%d %s", config.Width, config.Height, format)
+			}
+		})
+	}
+}
+
+func TestFitSizeTooLarge(t *testing.T) {
+	image := newImageAttachment(t, "image/jpeg", 400, 300)
+	data := &Attachment{MediaType: "application/octet-stream", Data: make([]byte, 50*1024)}
+	pdu := &MSendReq{Type: TYPE_SEND_REQ, To: []string{"+12345/TYPE=PLMN"}, ContentType: "application/vnd.wap.multipart.related", Attachments: []*Attachment{image, data}}
+
+	err := pdu.FitSize(40 * 1024)
+	if tooLarge, ok := err.(ErrorMessageTooLarge); !ok || tooLarge.MaxSize != 40*1024 || tooLarge.Size <= 50*1024 {
+		t.Errorf("FitSize = %#v, want ErrorMessageTooLarge", err)
+	}
+	if err := pdu.FitSize(0); err != nil {
+		t.Errorf("FitSize(0) = %v, want nil", err)
+	}
+}
+
+func TestFitSizeKeepsOrientation(t *testing.T) {
+	a := newImageAttachment(t, "image/jpeg", 800, 600)
+	a.Data = withJPEGOrientation(a.Data, 6)
+	pdu := &MSendReq{Type: TYPE_SEND_REQ, To: []string{"+12345/TYPE=PLMN"}, ContentType: "application/vnd.wap.multipart.related", Attachments: []*Attachment{a}}
+
+	if err := pdu.FitSize(50 * 1024); err != nil {
+		t.Fatalf("FitSize = %v, want nil", err)
+	}
+	if _, orientation, err := splitJPEGMetadata(a.Data); err != nil || orientation != 6 {
+		t.Errorf("Downscaled image orientation = %d, %v, want 6", orientation, err)
+	}
+}
+
+func TestScaleImage(t *testing.T) {
+	// 2x2 blocks of the same color average to that color, whatever the source type.
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {255, 255, 255, 255}}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.SetRGBA(x, y, colors[y/2*2+x/2])
+		}
+	}
+	ycbcr := image.NewYCbCr(src.Bounds(), image.YCbCrSubsampleRatio444)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			c := src.RGBAAt(x, y)
+			i := ycbcr.YOffset(x, y)
+			ycbcr.Y[i], ycbcr.Cb[i], ycbcr.Cr[i] = color.RGBToYCbCr(c.R, c.G, c.B)
+		}
+	}
+	nrgba := image.NewNRGBA(src.Bounds())
+	copy(nrgba.Pix, src.Pix)
+
+	for name, img := range map[string]image.Image{"RGBA": src, "YCbCr": ycbcr, "NRGBA": nrgba} {
+		t.Run(name, func(t *testing.T) {
+			scaled := scaleImage(img, 2, 2)
+			if scaled.Bounds() != image.Rect(0, 0, 2, 2) {
+				t.Fatalf("Scaled bounds are %v, want 2x2", scaled.Bounds())
+			}
+			for i, want := range colors {
+				r, g, b, a := scaled.At(i%2, i/2).RGBA()
+				got := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+				if diff(got.R, want.R) > 2 || diff(got.G, want.G) > 2 || diff(got.B, want.B) > 2 || got.A != want.A {
+					t.Errorf("Pixel %d is %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func diff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,129 @@
+package mms
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const (
+	smilContentId     = "<smil>"
+	smilLocation      = "smil.xml"
+	smilSlideDuration = "5000ms"
+)
+
+type smilDocument struct {
+	XMLName xml.Name     `xml:"smil"`
+	Regions []smilRegion `xml:"head>layout>region"`
+	Slides  []smilSlide  `xml:"body>par"`
+}
+
+type smilRegion struct {
+	Id     string `xml:"id,attr"`
+	Top    string `xml:"top,attr"`
+	Left   string `xml:"left,attr"`
+	Height string `xml:"height,attr"`
+	Width  string `xml:"width,attr"`
+	Fit    string `xml:"fit,attr,omitempty"`
+}
+
+type smilSlide struct {
+	Duration string `xml:"dur,attr,omitempty"`
+	Media    []smilMedia
+}
+
+type smilMedia struct {
+	XMLName xml.Name
+	Src     string `xml:"src,attr"`
+	Region  string `xml:"region,attr,omitempty"`
+}
+
+// smilRegions lays out images and videos above the text.
+var smilRegions = []smilRegion{
+	{Id: "Image", Top: "0%", Left: "0%", Height: "80%", Width: "100%", Fit: "meet"},
+	{Id: "Text", Top: "80%", Left: "0%", Height: "20%", Width: "100%"},
+}
+
+// AddSmil adds a SMIL presentation to a message without one. It has a slide per
+// image, video or audio attachment with the text attachments in a region below
+// them. Attachments without a Content-ID, or sharing one, are given one.
+func (pdu *MSendReq) AddSmil() error {
+	for _, a := range pdu.Attachments {
+		if a.isSmil() {
+			return nil
+		}
+	}
+	smil, err := newSmil(pdu.Attachments)
+	if err != nil {
+		return err
+	}
+	pdu.Attachments = append([]*Attachment{smil}, pdu.Attachments...)
+	pdu.ContentTypeStart = smil.ContentId
+	pdu.ContentTypeType = "application/smil"
+	return nil
+}
+
+func newSmil(attachments []*Attachment) (*Attachment, error) {
+	doc := smilDocument{Regions: smilRegions}
+	ids := make(map[string]bool)
+	var slideHasMedia, slideHasText bool
+	for i, a := range attachments {
+		if a.ContentId == "" || ids[a.ContentId] {
+			a.ContentId = fmt.Sprintf("<part%d>", i)
+		}
+		ids[a.ContentId] = true
+
+		element, region := smilElement(a.MediaType)
+		if element == "" {
+			continue
+		}
+		isText := element == "text"
+		if len(doc.Slides) == 0 || (isText && slideHasText) || (!isText && slideHasMedia) {
+			doc.Slides = append(doc.Slides, smilSlide{Duration: smilSlideDuration})
+			slideHasMedia, slideHasText = false, false
+		}
+		slide := &doc.Slides[len(doc.Slides)-1]
+		if isText {
+			slideHasText = true
+		} else {
+			slideHasMedia = true
+		}
+		if element == "audio" || element == "video" {
+			// Let the slide last as long as its audio or video.
+			slide.Duration = ""
+		}
+		slide.Media = append(slide.Media, smilMedia{
+			XMLName: xml.Name{Local: element},
+			Src:     "cid:" + strings.Trim(a.ContentId, "<>"),
+			Region:  region,
+		})
+	}
+
+	data, err := xml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate SMIL: %s", err)
+	}
+	return &Attachment{
+		MediaType:       "application/smil",
+		ContentId:       smilContentId,
+		ContentLocation: smilLocation,
+		Name:            smilLocation,
+		Data:            data,
+	}, nil
+}
+
+// smilElement returns the SMIL element and region presenting a part of
+// mediaType, or an empty element if it is not presented.
+func smilElement(mediaType string) (element, region string) {
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return "img", "Image"
+	case strings.HasPrefix(mediaType, "video/"):
+		return "video", "Image"
+	case strings.HasPrefix(mediaType, "audio/"):
+		return "audio", ""
+	case strings.HasPrefix(mediaType, "text/plain"):
+		return "text", "Text"
+	}
+	return "", ""
+}
@@ -0,0 +1,47 @@
+package mms
+
+import (
+	"testing"
+)
+
+func TestAddSmil(t *testing.T) {
+	attachments := []*Attachment{
+		{MediaType: "text/plain", ContentId: "<text0>"},
+		{MediaType: "image/jpeg", ContentId: "<image0>"},
+		{MediaType: "audio/ogg"},
+		{MediaType: "text/plain", ContentId: "<text0>"},
+		{MediaType: "text/x-vcard", ContentId: "<vcard0>"},
+	}
+	pdu := &MSendReq{Attachments: attachments}
+	if err := pdu.AddSmil(); err != nil {
+		t.Fatalf("AddSmil error = %v", err)
+	}
+
+	if len(pdu.Attachments) != len(attachments)+1 {
+		t.Fatalf("AddSmil has %d attachments, want %d", len(pdu.Attachments), len(attachments)+1)
+	}
+	smil := pdu.Attachments[0]
+	if smil.MediaType != "application/smil" || smil.ContentId != pdu.ContentTypeStart || pdu.ContentTypeType != "application/smil" {
+		t.Errorf("AddSmil start %q of type %q, SMIL part %q of type %q", pdu.ContentTypeStart, pdu.ContentTypeType, smil.ContentId, smil.MediaType)
+	}
+	wantIds := []string{"<text0>", "<image0>", "<part2>", "<part3>", "<vcard0>"}
+	for i := range wantIds {
+		if attachments[i].ContentId != wantIds[i] {
+			t.Errorf("Attachment %d ContentId = %q, want %q", i, attachments[i].ContentId, wantIds[i])
+		}
+	}
+	want := `<smil><head><layout>` +
+		`<region id="Image" top="0%" left="0%" height="80%" width="100%" fit="meet"></region>` +
+		`<region id="Text" top="80%" left="0%" height="20%" width="100%"></region>` +
+		`</layout></head><body>` +
+		`<par dur="5000ms"><text src="cid:text0" region="Text"></text><img src="cid:image0" region="Image"></img></par>` +
+		`<par><audio src="cid:part2"></audio><text src="cid:part3" region="Text"></text></par>` +
+		`</body></smil>`
+	if got := string(smil.Data); got != want {
+		t.Errorf("AddSmil SMIL = %s, want %s", got, want)
+	}
+
+	if err := pdu.AddSmil(); err != nil || len(pdu.Attachments) != len(attachments)+1 {
+		t.Errorf("AddSmil with SMIL = %v with %d attachments, want no new SMIL", err, len(pdu.Attachments))
+	}
+}
@@ -0,0 +1,46 @@
+package mms
+
+import "time"
+
+const (
+	// downloadTimeout is how long the message center has to send a message.
+	downloadTimeout = 3 * time.Minute
+	// uploadTimeout is how long the message center has to answer an upload.
+	uploadTimeout = 10 * time.Minute
+)
+
+// ProgressFunc is called with the number of bytes transferred so far and the total number
+// of bytes of a transfer, which is 0 if unknown.
+type ProgressFunc func(transferred, total uint64)
+
+// Transport transfers messages to and from the MMS center. Closing cancel stops
+// a transfer, ErrCancelled is returned then. The progress of a transfer is reported
+// to progress, if it isn't nil.
+type Transport interface {
+	// Download fetches the message at url and returns the path of the file holding it.
+	// If partialFile isn't empty, the data received by a previous interrupted download are
+	// read from it and the download is resumed, if the transport and the message center
+	// support it. The data received are kept in partialFile, if the download fails again.
+	Download(url, partialFile string, cancel <-chan struct{}, progress ProgressFunc) (string, error)
+	// Upload posts file to the message center msc and returns the path of the file
+	// holding its response.
+	Upload(file, msc string, cancel <-chan struct{}, progress ProgressFunc) (string, error)
+}
+
+// DownloadContent fetches the message the notification refers to with transport, resuming
+// the download partially received in partialFile (see Transport.Download), until cancel is
+// closed. If the total
+// size of the message isn't known to the transport, the Size of the notification is
+// reported to progress.
+func (pdu *MNotificationInd) DownloadContent(transport Transport, partialFile string, cancel <-chan struct{}, progress ProgressFunc) (string, error) {
+	if progress != nil {
+		reported := progress
+		progress = func(transferred, total uint64) {
+			if total == 0 {
+				total = pdu.Size
+			}
+			reported(transferred, total)
+		}
+	}
+	return transport.Download(pdu.ContentLocation, partialFile, cancel, progress)
+}
@@ -0,0 +1,282 @@
+package mms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const mmsMediaType = "application/vnd.wap.mms-message"
+
+// userAgent is the User-Agent udm sends with MMS transfers, some message centers only serve the
+// clients they know.
+const userAgent = "Mozilla/5.0 (Ubuntu; Mobile) WebKit/537.21"
+
+// errNotResumed is returned if the message center doesn't resume a download where it was interrupted.
+var errNotResumed = errors.New("download not resumed")
+
+// HTTPTransport transfers messages with net/http.
+type HTTPTransport struct {
+	client *http.Client
+	dir    string
+}
+
+// NewHTTPTransport returns a Transport going through the proxy at proxyHost and proxyPort, an empty
+// proxyHost means no proxy. Connections are bound to the network interface iface and made from its
+// address, if it isn't empty. The transferred files are written to dir, or the default temporary directory if
+// dir is empty.
+func NewHTTPTransport(proxyHost string, proxyPort int32, iface, dir string) (*HTTPTransport, error) {
+	dialer := &net.Dialer{}
+	if iface != "" {
+		addr, err := interfaceAddr(iface)
+		if err != nil {
+			return nil, err
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: addr}
+		dialer.Control = bindToDevice(iface)
+	}
+	transport := &http.Transport{DialContext: dialer.DialContext}
+	if proxyHost != "" {
+		transport.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: net.JoinHostPort(proxyHost, strconv.Itoa(int(proxyPort)))})
+	}
+	return &HTTPTransport{client: &http.Client{Transport: transport}, dir: dir}, nil
+}
+
+// interfaceAddr returns the IPv4 address of the network interface iface, or its first address if it
+// has no IPv4 one.
+func interfaceAddr(iface string) (net.IP, error) {
+	i, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := i.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var addr net.IP
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+		if addr == nil {
+			addr = ipNet.IP
+		}
+	}
+	if addr == nil {
+		return nil, fmt.Errorf("interface %s has no address", iface)
+	}
+	return addr, nil
+}
+
+// bindToDevice returns a net.Dialer Control function binding sockets to the network interface iface,
+// so they are routed through it even if the default route goes through another one.
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		}); cerr != nil {
+			return cerr
+		}
+		if err == syscall.EPERM {
+			// Kernels before 5.7 only let privileged processes bind, the local address still
+			// selects the interface where source routing is set up.
+			return nil
+		}
+		return err
+	}
+}
+
+// setHeaders sets the headers udm sends with MMS transfers on req.
+func setHeaders(req *http.Request) {
+	req.Header.Set("Accept", mmsMediaType)
+	req.Header.Set("User-Agent", userAgent)
+}
+
+// Download fetches the message at url. A download partially received in partialFile is resumed with
+// a Range request. If the message center doesn't support it, the message is fetched whole.
+func (t *HTTPTransport) Download(url, partialFile string, cancel <-chan struct{}, progress ProgressFunc) (string, error) {
+	var offset int64
+	if partialFile != "" {
+		if fi, err := os.Stat(partialFile); err == nil {
+			offset = fi.Size()
+		}
+	}
+
+	filePath, err := t.download(url, partialFile, offset, cancel, progress)
+	if err == errNotResumed {
+		log.Print("Download of ", url, " can't be resumed, fetching it whole")
+		filePath, err = t.download(url, partialFile, 0, cancel, progress)
+	}
+	if err == context.DeadlineExceeded {
+		return "", fmt.Errorf("Download timeout exceeded while fetching %s", url)
+	}
+	return filePath, err
+}
+
+func (t *HTTPTransport) download(url, partialFile string, offset int64, cancel <-chan struct{}, progress ProgressFunc) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	setHeaders(req)
+	if offset > 0 {
+		log.Print("Resuming download of ", url, " from byte ", offset)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	} else {
+		log.Print("Starting download of ", url)
+	}
+	return t.do(req, partialFile, offset, cancel, progress, downloadTimeout)
+}
+
+func (t *HTTPTransport) Upload(file, msc string, cancel <-chan struct{}, progress ProgressFunc) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	log.Print("Starting upload of ", file, " to ", msc)
+	var body io.Reader = f
+	if progress != nil {
+		body = io.TeeReader(f, &progressWriter{progress: progress, total: uint64(fi.Size())})
+	}
+	req, err := http.NewRequest(http.MethodPost, msc, body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = fi.Size()
+	setHeaders(req)
+	req.Header.Set("Content-Type", mmsMediaType)
+	responseFile, err := t.do(req, "", 0, cancel, nil, uploadTimeout)
+	if err == context.DeadlineExceeded {
+		return "", ErrUploadTimeout
+	}
+	return responseFile, err
+}
+
+// do sends req and writes the response body to a file, whose path is returned. The context errors are
+// returned if req takes longer than timeout and ErrCancelled if cancel is closed.
+// If partialFile isn't empty, the response is written to it, appended at offset to a partial content.
+// The progress of receiving the response is reported to progress, if it isn't nil.
+func (t *HTTPTransport) do(req *http.Request, partialFile string, offset int64, cancel <-chan struct{}, progress ProgressFunc, timeout time.Duration) (string, error) {
+	ctx, stop := context.WithTimeout(req.Context(), timeout)
+	defer stop()
+	cancelled := make(chan struct{})
+	go func() {
+		select {
+		case <-cancel:
+			close(cancelled)
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+
+	filePath, err := t.receive(req.WithContext(ctx), partialFile, offset, progress)
+	select {
+	case <-cancelled:
+		if err == nil {
+			os.Remove(filePath)
+		}
+		return "", ErrCancelled
+	default:
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return "", context.DeadlineExceeded
+	}
+	return filePath, err
+}
+
+func (t *HTTPTransport) receive(req *http.Request, partialFile string, offset int64, progress ProgressFunc) (string, error) {
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var f *os.File
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		if contentRangeStart(resp.Header.Get("Content-Range")) != offset {
+			return "", errNotResumed
+		}
+		f, err = os.OpenFile(partialFile, os.O_WRONLY|os.O_APPEND, 0600)
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		return "", errNotResumed
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	case partialFile != "":
+		f, err = os.Create(partialFile)
+	default:
+		f, err = ioutil.TempFile(t.dir, "transfer")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var body io.Reader = resp.Body
+	if progress != nil {
+		pw := &progressWriter{progress: progress}
+		if resp.StatusCode == http.StatusPartialContent {
+			pw.transferred = uint64(offset)
+		}
+		if resp.ContentLength >= 0 {
+			pw.total = pw.transferred + uint64(resp.ContentLength)
+		}
+		body = io.TeeReader(resp.Body, pw)
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		if partialFile == "" {
+			os.Remove(f.Name())
+		}
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	log.Print("Received ", f.Name(), " from ", req.URL)
+	return f.Name(), nil
+}
+
+// progressWriter reports the bytes written to it as transferred to progress.
+type progressWriter struct {
+	progress    ProgressFunc
+	transferred uint64
+	total       uint64
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.transferred += uint64(len(p))
+	pw.progress(pw.transferred, pw.total)
+	return len(p), nil
+}
+
+// contentRangeStart returns the first byte position of the Content-Range header value contentRange,
+// or -1 if it isn't a byte range.
+func contentRangeStart(contentRange string) int64 {
+	var start int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-", &start); err != nil {
+		return -1
+	}
+	return start
+}
@@ -0,0 +1,307 @@
+package mms
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestTransport(t *testing.T, proxy *httptest.Server, iface string) (*HTTPTransport, string) {
+	dir, err := ioutil.TempDir("", "nuntium-transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var host string
+	var port int
+	if proxy != nil {
+		u, _ := url.Parse(proxy.URL)
+		host = u.Hostname()
+		port, _ = strconv.Atoi(u.Port())
+	}
+	transport, err := NewHTTPTransport(host, int32(port), iface, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("NewHTTPTransport = %v", err)
+	}
+	return transport, dir
+}
+
+func checkFile(t *testing.T, filePath, dir string, want []byte) {
+	if filepath.Dir(filePath) != dir {
+		t.Errorf("File %s is not in %s", filePath, dir)
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("File holds %q, want %q", data, want)
+	}
+}
+
+func TestHTTPTransportDownload(t *testing.T) {
+	mmsc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/message" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Accept") != mmsMediaType {
+			t.Errorf("Accept = %q", r.Header.Get("Accept"))
+		}
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("User-Agent = %q, want %q", r.Header.Get("User-Agent"), userAgent)
+		}
+		w.Write([]byte("m-retrieve.conf"))
+	}))
+	defer mmsc.Close()
+	transport, dir := newTestTransport(t, nil, "")
+	defer os.RemoveAll(dir)
+
+	filePath, err := (&MNotificationInd{ContentLocation: mmsc.URL + "/message"}).DownloadContent(transport, "", nil, nil)
+	if err != nil {
+		t.Fatalf("DownloadContent = %v", err)
+	}
+	checkFile(t, filePath, dir, []byte("m-retrieve.conf"))
+
+	if filePath, err := transport.Download(mmsc.URL+"/expired", "", nil, nil); err == nil {
+		t.Errorf("Download of a missing message = %s, want an error", filePath)
+	}
+}
+
+func TestHTTPTransportUpload(t *testing.T) {
+	mmsc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != mmsMediaType || string(body) != "m-send.req" {
+			t.Errorf("MMSC received %s %s %q", r.Method, r.Header.Get("Content-Type"), body)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("m-send.conf"))
+	}))
+	defer mmsc.Close()
+	transport, dir := newTestTransport(t, nil, "")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "m-send.req")
+	if err := ioutil.WriteFile(file, []byte("m-send.req"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filePath, err := transport.Upload(file, mmsc.URL, nil, nil)
+	if err != nil {
+		t.Fatalf("Upload = %v", err)
+	}
+	checkFile(t, filePath, dir, []byte("m-send.conf"))
+
+	if _, err := transport.Upload(filepath.Join(dir, "missing"), mmsc.URL, nil, nil); err == nil {
+		t.Errorf("Upload of a missing file = nil, want an error")
+	}
+}
+
+func TestHTTPTransportProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Proxied requests hold the absolute URL of the MMSC.
+		if r.URL.Host != "mmsc.example.com" || r.URL.Path != "/message" {
+			t.Errorf("Proxy received a request for %s", r.URL)
+		}
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+	transport, dir := newTestTransport(t, proxy, "")
+	defer os.RemoveAll(dir)
+
+	filePath, err := transport.Download("http://mmsc.example.com/message", "", nil, nil)
+	if err != nil {
+		t.Fatalf("Download = %v", err)
+	}
+	checkFile(t, filePath, dir, []byte("proxied"))
+}
+
+func TestHTTPTransportInterface(t *testing.T) {
+	var loopback string
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			loopback = iface.Name
+			break
+		}
+	}
+	if loopback == "" {
+		t.Skip("No loopback interface")
+	}
+	mmsc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	}))
+	defer mmsc.Close()
+	transport, dir := newTestTransport(t, nil, loopback)
+	defer os.RemoveAll(dir)
+
+	filePath, err := transport.Download(mmsc.URL, "", nil, nil)
+	if err != nil {
+		t.Fatalf("Download = %v", err)
+	}
+	data, _ := ioutil.ReadFile(filePath)
+	if host, _, _ := net.SplitHostPort(string(data)); !net.ParseIP(host).IsLoopback() {
+		t.Errorf("Connected from %s, want the %s address", data, loopback)
+	}
+
+	if _, err := NewHTTPTransport("", 0, "nuntium-missing0", dir); err == nil {
+		t.Errorf("NewHTTPTransport with a missing interface = nil, want an error")
+	}
+}
+
+func TestHTTPTransportResume(t *testing.T) {
+	const message = "m-retrieve.conf"
+	serveRanges := func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(message))
+	}
+	ignoreRanges := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(message))
+	}
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		partial string
+		ranged  bool
+	}{
+		{"resumed", serveRanges, "m-retr", true},
+		{"no partial", serveRanges, "", false},
+		{"ranges unsupported", ignoreRanges, "m-retr", true},
+		{"range not satisfiable", serveRanges, message + "trailing", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var ranged int32
+			mmsc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "" {
+					atomic.StoreInt32(&ranged, 1)
+				}
+				c.handler(w, r)
+			}))
+			defer mmsc.Close()
+			transport, dir := newTestTransport(t, nil, "")
+			defer os.RemoveAll(dir)
+			partialFile := filepath.Join(dir, "message.part")
+			if c.partial != "" {
+				if err := ioutil.WriteFile(partialFile, []byte(c.partial), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			filePath, err := transport.Download(mmsc.URL, partialFile, nil, nil)
+			if err != nil {
+				t.Fatalf("Download = %v", err)
+			}
+			if filePath != partialFile {
+				t.Errorf("Downloaded to %s, want %s", filePath, partialFile)
+			}
+			checkFile(t, filePath, dir, []byte(message))
+			if got := atomic.LoadInt32(&ranged) == 1; got != c.ranged {
+				t.Errorf("Range requested: %t, want %t", got, c.ranged)
+			}
+		})
+	}
+}
+
+func TestHTTPTransportInterrupted(t *testing.T) {
+	mmsc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "15")
+		w.Write([]byte("m-retr"))
+	}))
+	defer mmsc.Close()
+	transport, dir := newTestTransport(t, nil, "")
+	defer os.RemoveAll(dir)
+	partialFile := filepath.Join(dir, "message.part")
+
+	if _, err := transport.Download(mmsc.URL, partialFile, nil, nil); err == nil {
+		t.Fatal("Interrupted download = nil, want an error")
+	}
+	checkFile(t, partialFile, dir, []byte("m-retr"))
+}
+
+func TestHTTPTransportProgress(t *testing.T) {
+	mmsc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sized":
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader("m-retrieve.conf"))
+		default:
+			// Flushing before writing the body makes the response chunked, of an unknown length.
+			w.(http.Flusher).Flush()
+			w.Write([]byte("m-retrieve.conf"))
+		}
+	}))
+	defer mmsc.Close()
+	transport, dir := newTestTransport(t, nil, "")
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		path             string
+		partial          string
+		notificationSize uint64
+		wantTotal        uint64
+	}{
+		{"/sized", "", 100, 15},
+		{"/sized", "m-retr", 100, 15},
+		{"/chunked", "", 100, 100},
+		{"/chunked", "", 0, 0},
+	}
+	for _, c := range cases {
+		var partialFile string
+		if c.partial != "" {
+			partialFile = filepath.Join(dir, "message.part")
+			if err := ioutil.WriteFile(partialFile, []byte(c.partial), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var transferred, total uint64
+		progress := func(tr, tot uint64) {
+			transferred, total = tr, tot
+		}
+		pdu := &MNotificationInd{ContentLocation: mmsc.URL + c.path, Size: c.notificationSize}
+		if _, err := pdu.DownloadContent(transport, partialFile, nil, progress); err != nil {
+			t.Fatalf("DownloadContent(%s) = %v", c.path, err)
+		}
+		if transferred != 15 || total != c.wantTotal {
+			t.Errorf("DownloadContent(%s, %q) progress = %d/%d, want 15/%d", c.path, c.partial, transferred, total, c.wantTotal)
+		}
+	}
+}
+
+func TestHTTPTransportCancel(t *testing.T) {
+	received := make(chan struct{})
+	mmsc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-r.Context().Done()
+	}))
+	defer mmsc.Close()
+	transport, dir := newTestTransport(t, nil, "")
+	defer os.RemoveAll(dir)
+
+	cancel := make(chan struct{})
+	go func() {
+		<-received
+		close(cancel)
+	}()
+	done := make(chan error)
+	go func() {
+		_, err := transport.Download(mmsc.URL, "", cancel, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != ErrCancelled {
+			t.Errorf("Download = %v, want ErrCancelled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Download wasn't cancelled")
+	}
+}
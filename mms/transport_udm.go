@@ -0,0 +1,122 @@
+/*
+ * Copyright 2014 Canonical Ltd.
+ *
+ * Authors:
+ * Sergio Schvezov: sergio.schvezov@cannical.com
+ *
+ * This file is part of mms.
+ *
+ * mms is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * mms is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mms
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"launchpad.net/udm"
+)
+
+// UDMTransport transfers messages with the Ubuntu Download Manager.
+type UDMTransport struct {
+	proxyHost string
+	proxyPort int32
+}
+
+// NewUDMTransport returns a Transport going through the proxy at proxyHost and proxyPort, an empty
+// proxyHost means no proxy.
+func NewUDMTransport(proxyHost string, proxyPort int32) *UDMTransport {
+	return &UDMTransport{proxyHost: proxyHost, proxyPort: proxyPort}
+}
+
+// Download fetches the message at url. Downloads can't be resumed with udm, so partialFile is ignored.
+func (t *UDMTransport) Download(url, partialFile string, cancel <-chan struct{}, progress ProgressFunc) (string, error) {
+	downloadManager, err := udm.NewDownloadManager()
+	if err != nil {
+		return "", err
+	}
+	download, err := downloadManager.CreateMmsDownload(url, t.proxyHost, t.proxyPort)
+	if err != nil {
+		return "", err
+	}
+	f := download.Finished()
+	p := download.DownloadProgress()
+	e := download.Error()
+	log.Print("Starting download of ", url, " with proxy ", t.proxyHost, ":", t.proxyPort)
+	download.Start()
+	for {
+		select {
+		case downloadProgress := <-p:
+			log.Print("Progress:", downloadProgress.Total, downloadProgress.Received)
+			if progress != nil {
+				progress(downloadProgress.Received, downloadProgress.Total)
+			}
+		case downloadFilePath := <-f:
+			log.Print("File downloaded to ", downloadFilePath)
+			return downloadFilePath, nil
+		case <-time.After(downloadTimeout):
+			return "", fmt.Errorf("Download timeout exceeded while fetching %s", url)
+		case err := <-e:
+			return "", err
+		case <-cancel:
+			log.Print("Cancelling download of ", url)
+			if err := download.Cancel(); err != nil {
+				log.Print("Cannot cancel download of ", url, ": ", err)
+			}
+			return "", ErrCancelled
+		}
+	}
+}
+
+func (t *UDMTransport) Upload(file, msc string, cancel <-chan struct{}, progress ProgressFunc) (string, error) {
+	udm, err := udm.NewUploadManager()
+	if err != nil {
+		return "", err
+	}
+	upload, err := udm.CreateMmsUpload(msc, file, t.proxyHost, t.proxyPort)
+	if err != nil {
+		return "", err
+	}
+	f := upload.Finished()
+	p := upload.UploadProgress()
+	e := upload.Error()
+	log.Print("Starting upload of ", file, " to ", msc, " with proxy ", t.proxyHost, ":", t.proxyPort)
+	if err := upload.Start(); err != nil {
+		return "", err
+	}
+
+	for {
+		select {
+		case uploadProgress := <-p:
+			log.Print("Progress:", uploadProgress.Total, uploadProgress.Received)
+			if progress != nil {
+				progress(uploadProgress.Received, uploadProgress.Total)
+			}
+		case responseFile := <-f:
+			log.Print("File ", responseFile, " returned in upload")
+			return responseFile, nil
+		case <-time.After(uploadTimeout):
+			return "", ErrUploadTimeout
+		case err := <-e:
+			return "", err
+		case <-cancel:
+			log.Print("Cancelling upload of ", file)
+			if err := upload.Cancel(); err != nil {
+				log.Print("Cannot cancel upload of ", file, ": ", err)
+			}
+			return "", ErrCancelled
+		}
+	}
+}
@@ -343,6 +343,24 @@ func (s *ContextTestSuite) TestGetProxy(c *C) {
 	c.Check(p, DeepEquals, proxy)
 }
 
+func (s *ContextTestSuite) TestGetInterface(c *C) {
+	context := OfonoContext{
+		ObjectPath: "/ril_0/context1",
+		Properties: makeGenericContextProperty("Context1", contextTypeMMS, true, true, true, false),
+	}
+	_, err := context.GetInterface()
+	c.Check(err, NotNil)
+
+	m := make(map[interface{}]interface{})
+	iface := dbus.Variant{"rmnet_usb0"}
+	m["Interface"] = &iface
+	context.Properties["Settings"] = dbus.Variant{m}
+
+	i, err := context.GetInterface()
+	c.Assert(err, IsNil)
+	c.Check(i, Equals, "rmnet_usb0")
+}
+
 func (s *ContextTestSuite) TestGetProxyNoProxy(c *C) {
 	context := OfonoContext{
 		ObjectPath: "/ril_0/context1",
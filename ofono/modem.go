@@ -60,6 +60,7 @@ type Modem struct {
 	endWatch               chan bool
 	PushInterfaceAvailable chan bool
 	pushInterfaceAvailable bool
+	OnlineChanged          chan bool
 	online                 bool
 	modemSignal, simSignal *dbus.SignalWatch
 }
@@ -72,6 +73,7 @@ type ProxyInfo struct {
 const PROP_SETTINGS = "Settings"
 const SETTINGS_PROXY = "Proxy"
 const SETTINGS_PROXYPORT = "ProxyPort"
+const SETTINGS_INTERFACE = "Interface"
 const DBUS_CALL_GET_PROPERTIES = "GetProperties"
 
 func (p ProxyInfo) String() string {
@@ -94,6 +96,7 @@ func NewModem(conn *dbus.Connection, objectPath dbus.ObjectPath) *Modem {
 		IdentityAdded:          make(chan string),
 		IdentityRemoved:        make(chan string),
 		PushInterfaceAvailable: make(chan bool),
+		OnlineChanged:          make(chan bool),
 		endWatch:               make(chan bool),
 		PushAgent:              NewPushAgent(objectPath),
 	}
@@ -190,6 +193,7 @@ func (modem *Modem) handleOnlineState(propValue dbus.Variant) {
 	modem.online = reflect.ValueOf(propValue.Value).Bool()
 	if modem.online != origState {
 		log.Printf("Modem online: %t", modem.online)
+		modem.OnlineChanged <- modem.online
 	}
 }
 
@@ -429,6 +433,27 @@ func (oContext OfonoContext) GetMessageCenter() (string, error) {
 	}
 }
 
+// GetInterface returns the network interface of the active context.
+func (oContext OfonoContext) GetInterface() (string, error) {
+	v, ok := oContext.Properties[PROP_SETTINGS]
+	if !ok {
+		return "", errors.New("context has no settings")
+	}
+	settings, ok := v.Value.(map[interface{}]interface{})
+	if !ok {
+		return "", errors.New("context settings are not a dictionary")
+	}
+	iface_v, ok := settings[SETTINGS_INTERFACE].(*dbus.Variant)
+	if !ok {
+		return "", errors.New("context setting for the Interface is missing")
+	}
+	iface, ok := iface_v.Value.(string)
+	if !ok || iface == "" {
+		return "", errors.New("context setting for the Interface is empty")
+	}
+	return iface, nil
+}
+
 func (oContext OfonoContext) GetProxy() (proxyInfo ProxyInfo, err error) {
 	proxy := oContext.settingsProxy()
 	// we need to support empty proxies
@@ -57,6 +57,9 @@ func NewDecoder(data []byte) *PushPDUDecoder {
 // provided to and reported from the underlying transport. The Data field starts immediately after the Headers field and
 // ends at the end of the SDU.
 func (dec *PushPDUDecoder) Decode(pdu *PushPDU) (err error) {
+	if len(dec.Data) < 2 {
+		return mms.ErrorDecodeShortData{Length: len(dec.Data), Expected: 2}
+	}
 	if PDU(dec.Data[1]) != PUSH {
 		return errors.New(fmt.Sprintf("%x != %x is not a push PDU", PDU(dec.Data[1]), PUSH))
 	}
@@ -66,6 +69,9 @@ func (dec *PushPDUDecoder) Decode(pdu *PushPDU) (err error) {
 	if _, err = dec.ReadUintVar(&rValue, "HeaderLength"); err != nil {
 		return err
 	}
+	if pdu.HeaderLength > uint64(len(dec.Data)-3) {
+		return mms.ErrorDecodeShortData{Length: len(dec.Data), Expected: len(dec.Data) + 1}
+	}
 	if err = dec.ReadMediaType(&rValue, "ContentType"); err != nil {
 		return err
 	}
@@ -82,6 +88,10 @@ func (dec *PushPDUDecoder) decodeHeaders(pdu *PushPDU, hdrLengthRemain int) erro
 	rValue := reflect.ValueOf(pdu).Elem()
 	var err error
 	for ; dec.Offset < (hdrLengthRemain + dec.Offset); dec.Offset++ {
+		if dec.Offset >= len(dec.Data) {
+			return mms.ErrorDecodeShortData{Length: len(dec.Data), Expected: dec.Offset}
+		}
+		hdrOffset := dec.Offset
 		param := dec.Data[dec.Offset] & 0x7F
 		switch param {
 		case X_WAP_APPLICATION_ID:
@@ -89,8 +99,7 @@ func (dec *PushPDUDecoder) decodeHeaders(pdu *PushPDU, hdrLengthRemain int) erro
 		case PUSH_FLAG:
 			_, err = dec.ReadShortInteger(&rValue, "PushFlag")
 		case ENCODING_VERSION:
-			dec.Offset++
-			pdu.EncodingVersion = dec.Data[dec.Offset] & 0x7F
+			_, err = dec.ReadShortInteger(&rValue, "EncodingVersion")
 			dec.Offset++
 		case CONTENT_LENGTH:
 			_, err = dec.ReadInteger(&rValue, "ContentLength")
@@ -102,7 +111,7 @@ func (dec *PushPDUDecoder) decodeHeaders(pdu *PushPDU, hdrLengthRemain int) erro
 			err = fmt.Errorf("Unhandled header data %#x @%d", dec.Data[dec.Offset], dec.Offset)
 		}
 		if err != nil {
-			return fmt.Errorf("error while decoding %#x @%d: %v", param, dec.Offset, err)
+			return mms.ErrorDecodeHeader{Header: param, Offset: hdrOffset, Err: err}
 		} else if pdu.ApplicationId != 0 {
 			return nil
 		}
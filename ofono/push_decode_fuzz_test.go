@@ -0,0 +1,37 @@
+//go:build go1.18
+// +build go1.18
+
+package ofono
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ubports/nuntium/mms"
+)
+
+// FuzzPushPDUDecode feeds arbitrary data to the push decoder and the decoder
+// for the MMS PDU it carries, decoding must fail with an error and never panic.
+func FuzzPushPDUDecode(f *testing.F) {
+	f.Add([]byte{
+		0x00, 0x06, 0x07, 0xbe, 0xaf, 0x84, 0x8d, 0xf2, 0xb4, 0x81, 0x8c, 0x82, 0x98,
+		0x41, 0x42, 0x00, 0x8d, 0x92, 0x89, 0x05, 0x80, 0x2b, 0x33, 0x35, 0x00, 0x86,
+		0x81, 0x8a, 0x80, 0x8e, 0x03, 0x03, 0x15, 0x85, 0x88, 0x05, 0x81, 0x03, 0x03,
+		0xf4, 0x7f, 0x83, 0x68, 0x74, 0x74, 0x70, 0x00,
+	})
+	f.Add([]byte{
+		0x01, 0x06, 0x07, 0xbe, 0x8d, 0xf0, 0xaf, 0x84, 0xb4, 0x84, 0x8c, 0x82, 0x98,
+		0x41, 0x00, 0x8d, 0x93, 0x89, 0x04, 0x80, 0x2b, 0x33, 0x00,
+	})
+	f.Add([]byte{0x00, 0x07, 0x07, 0xbe, 0xaf, 0x84, 0x8d, 0xf2, 0xb4, 0x81, 0x8c})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pdu := new(PushPDU)
+		if err := NewDecoder(data).Decode(pdu); err != nil {
+			return
+		}
+		if mType, err := mms.GetMessageType(pdu.Data); err == nil && mType == mms.TYPE_NOTIFICATION_IND {
+			mms.NewDecoder(pdu.Data).Decode(mms.NewMNotificationInd(time.Time{}))
+		}
+	})
+}
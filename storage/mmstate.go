@@ -21,7 +21,11 @@
 
 package storage
 
-import "github.com/ubports/nuntium/mms"
+import (
+	"time"
+
+	"github.com/ubports/nuntium/mms"
+)
 
 //SendInfo is a map where every key is a destination and the value can be any of:
 //
@@ -35,9 +39,31 @@ import "github.com/ubports/nuntium/mms"
 // - "unreachable": recipient is not reachable.
 type SendInfo map[string]string
 
+// DeliveryStatus maps the X-Mms-Status value of a m-delivery.ind to the
+// SendInfo value for the recipient it reports on.
+func DeliveryStatus(status byte) string {
+	switch status {
+	case mms.STATUS_EXPIRED:
+		return EXPIRED
+	case mms.STATUS_RETRIEVED:
+		return RETRIEVED
+	case mms.STATUS_REJECTED:
+		return REJECTED
+	case mms.STATUS_DEFERRED:
+		return DEFERRED
+	case mms.STATUS_FORWARDED:
+		return FORWARDED
+	case mms.STATUS_UNREACHABLE:
+		return UNREACHABLE
+	}
+	// Unrecognized, indeterminate and any reserved value.
+	return INDETERMINATE
+}
+
 //Status represents an MMS' state
 //
-// Id represents the transaction ID for the MMS if using delivery request reports
+// Id represents the transaction ID for the MMS if using delivery request reports,
+// for sent messages it holds the Message-ID assigned by the MMS center
 //
 // State can be:
 // - For incoming messages:
@@ -57,6 +83,15 @@ type SendInfo map[string]string
 // MNotificationInd holds the received m-Notify.Ind until PDU downloaded (is not nil when State is "notification").
 //
 // TelepathyErrorNotified holds information whether telepathy-ofono was notified of some message handling error.
+//
+// MReadRecInd holds the m-Read-Rec.Ind to send to the originator once the incoming message is read (is nil if no read report is pending).
+//
+// Attempts holds the number of failed attempts to send an outgoing message, or download an incoming one, and
+// NextAttempt when it is retried (is zero if no retry is scheduled).
+//
+// ResponseStatus and ResponseText hold the last m-send.conf response of the MMS center to an outgoing message.
+//
+// Sent holds when an outgoing message was accepted by the MMS center (is zero if it is not SENT).
 type MMSState struct {
 	Id                     string
 	State                  string
@@ -65,6 +100,12 @@ type MMSState struct {
 	ModemId                string
 	MNotificationInd       *mms.MNotificationInd
 	TelepathyErrorNotified bool
+	MReadRecInd            *mms.MReadRecInd
+	Attempts               int
+	NextAttempt            time.Time
+	ResponseStatus         byte
+	ResponseText           string
+	Sent                   time.Time
 }
 
 func (m MMSState) IsIncoming() bool {
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"launchpad.net/go-xdg/v0"
+)
+
+var settingsPath string = filepath.Join(filepath.Base(os.Args[0]), "settings")
+
+var settingsMutex sync.Mutex
+
+// Settings maps the names of the service properties a client changed to their values.
+type Settings map[string]interface{}
+
+// SetSetting stores value as the setting name of identity, to be restored by GetSettings after a restart.
+func SetSetting(identity, name string, value interface{}) error {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	settingsFilePath, err := xdg.Data.Ensure(settingsPath)
+	if err != nil {
+		return err
+	}
+	identities, err := readSettings(settingsFilePath)
+	if err != nil {
+		log.Printf("Cannot read previous settings, replacing them: %v", err)
+		identities = make(map[string]Settings)
+	}
+	if identities[identity] == nil {
+		identities[identity] = make(Settings)
+	}
+	identities[identity][name] = value
+
+	data, err := json.Marshal(identities)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(settingsFilePath, data, 0600)
+}
+
+// GetSettings returns the stored settings of identity. Numbers are returned as float64, as decoded from json.
+// An identity without stored settings has none.
+func GetSettings(identity string) (Settings, error) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	settingsFilePath, err := xdg.Data.Find(settingsPath)
+	if err != nil {
+		// Nothing stored yet.
+		return Settings{}, nil
+	}
+	identities, err := readSettings(settingsFilePath)
+	if err != nil {
+		return Settings{}, err
+	}
+	if settings, ok := identities[identity]; ok {
+		return settings, nil
+	}
+	return Settings{}, nil
+}
+
+// readSettings returns the settings of all identities stored in storePath, none if it doesn't exist.
+func readSettings(storePath string) (map[string]Settings, error) {
+	identities := make(map[string]Settings)
+	data, err := ioutil.ReadFile(storePath)
+	if os.IsNotExist(err) || len(data) == 0 {
+		return identities, nil
+	}
+	if err != nil {
+		return identities, err
+	}
+	if err := json.Unmarshal(data, &identities); err != nil {
+		return identities, err
+	}
+	return identities, nil
+}
@@ -23,8 +23,11 @@ package storage
 
 import (
 	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path"
@@ -66,6 +69,14 @@ func Create(modemId string, mNotificationInd *mms.MNotificationInd) (MMSState, e
 func Destroy(uuid string) (err error) {
 	errs := Multierror{}
 
+	if mmsState, err := GetMMSState(uuid); err == nil && mmsState.State == SENT && mmsState.Id != "" {
+		if path, err := xdg.Data.Find(sentIndexPath(mmsState.Id)); err == nil {
+			if err := os.Remove(path); err != nil {
+				errs = append(errs, ErrorRemovingFile{path, err})
+			}
+		}
+	}
+
 	if path, err := xdg.Data.Find(path.Join(SUBPATH, uuid+".db")); err == nil {
 		if err := os.Remove(path); err != nil {
 			errs = append(errs, ErrorRemovingFile{path, err})
@@ -80,18 +91,51 @@ func Destroy(uuid string) (err error) {
 		}
 	}
 
+	if path, err := xdg.Data.Ensure(path.Join(SUBPATH, uuid+".db")); err == nil {
+		textParts, _ := filepath.Glob(filepath.Join(filepath.Dir(path), uuid+".part*.txt"))
+		for _, textPart := range textParts {
+			if err := os.Remove(textPart); err != nil {
+				errs = append(errs, ErrorRemovingFile{textPart, err})
+			}
+		}
+	}
+
 	if path, err := xdg.Cache.Find(path.Join(SUBPATH, uuid+".m-notifyresp.ind")); err == nil {
 		if err := os.Remove(path); err != nil {
 			errs = append(errs, ErrorRemovingFile{path, err})
 		}
 	}
 
+	if path, err := xdg.Cache.Find(path.Join(SUBPATH, uuid+".m-acknowledge.ind")); err == nil {
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, ErrorRemovingFile{path, err})
+		}
+	}
+
+	if path, err := GetSendFile(uuid); err == nil {
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, ErrorRemovingFile{path, err})
+		}
+	}
+
 	if path, err := xdg.Cache.Find(path.Join(SUBPATH, uuid+".m-send.req")); err == nil {
 		if err := os.Remove(path); err != nil {
 			errs = append(errs, ErrorRemovingFile{path, err})
 		}
 	}
 
+	if path, err := xdg.Cache.Find(path.Join(SUBPATH, uuid+".m-read-rec.ind")); err == nil {
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, ErrorRemovingFile{path, err})
+		}
+	}
+
+	if path, err := xdg.Cache.Find(path.Join(SUBPATH, uuid+".part")); err == nil {
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, ErrorRemovingFile{path, err})
+		}
+	}
+
 	return errs.Result()
 }
 
@@ -111,6 +155,76 @@ func CreateResponseFile(uuid string) (*os.File, error) {
 	return os.Create(filePath)
 }
 
+// Creates an empty .m-acknowledge.ind file in storage for message with provided uuid.
+// Returns a nil file descriptor and a non nil error if no message stored uuid or file creation failed.
+// On success returns an open file descriptor and nil error.
+func CreateAcknowledgeFile(uuid string) (*os.File, error) {
+	_, err := GetMMSState(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving message state: %w", err)
+	}
+
+	filePath, err := xdg.Cache.Ensure(path.Join(SUBPATH, uuid+".m-acknowledge.ind"))
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(filePath)
+}
+
+// Returns the path of the cache file, which keeps the partially downloaded content of message with provided uuid,
+// so that an interrupted download can be resumed. The file doesn't need to exist.
+func GetPartialDownload(uuid string) (string, error) {
+	return xdg.Cache.Ensure(path.Join(SUBPATH, uuid+".part"))
+}
+
+// Moves the partially downloaded content of message with fromUUID, if there is any, to message with toUUID.
+func MovePartialDownload(fromUUID, toUUID string) error {
+	fromPath, err := xdg.Cache.Find(path.Join(SUBPATH, fromUUID+".part"))
+	if err != nil {
+		// Nothing downloaded.
+		return nil
+	}
+	toPath, err := GetPartialDownload(toUUID)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fromPath, toPath)
+}
+
+// Returns the cache directory, which files transferred to and from the MMS center are written to.
+func GetTransferDir() (string, error) {
+	filePath, err := xdg.Cache.Ensure(path.Join(SUBPATH, "transfer"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(filePath), nil
+}
+
+// Creates an empty .m-read-rec.ind file in storage for message with provided uuid.
+// The message doesn't need to be stored, as the read report can be sent after the message was deleted.
+// Returns a nil file descriptor and a non nil error if file creation failed.
+// On success returns an open file descriptor and nil error.
+func CreateReadReportFile(uuid string) (*os.File, error) {
+	filePath, err := xdg.Cache.Ensure(path.Join(SUBPATH, uuid+".m-read-rec.ind"))
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(filePath)
+}
+
+// Stores the UTF-8 transcoded text of the data part at index of the message identified by uuid alongside the message.
+// Returns the path to the stored file and a nil error on success.
+func SaveTextPart(uuid string, index int, text string) (string, error) {
+	filePath, err := xdg.Data.Ensure(path.Join(SUBPATH, fmt.Sprintf("%s.part%d.txt", uuid, index)))
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filePath, []byte(text), 0600); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
 // Updates MNotificationInd field in stored MMSState.
 // Returns the stored message state and a nil error on success.
 // If message not in storage or other fail it returns empty or previous state and a non nil error.
@@ -262,13 +376,19 @@ func SetTelepathyErrorNotified(uuid string) (MMSState, error) {
 	return newState, nil
 }
 
-// Saves an message with DRAFT state to storage and creates an empty .m-send.req file in storage for message with provided uuid.
+// Saves an message with DRAFT state and recipients pending delivery report (NONE) to storage and creates an empty .m-send.req file in storage for message with provided uuid.
+// The .m-send.req file is kept in data storage, so that the message can be sent after a restart, until it is sent or destroyed.
 // Returns a nil file descriptor and a non nil error if message store error or send file creation failed.
 // On success returns an open file descriptor to the send file and nil error.
 // Note: If there is an message stored under uuid, the message is rewritten.
-func CreateSendFile(uuid string) (*os.File, error) {
+func CreateSendFile(modemId, uuid string, recipients []string) (*os.File, error) {
 	state := MMSState{
-		State: DRAFT,
+		State:     DRAFT,
+		SendState: make(SendInfo),
+		ModemId:   modemId,
+	}
+	for _, recipient := range recipients {
+		state.SendState[recipient] = NONE
 	}
 	storePath, err := xdg.Data.Ensure(path.Join(SUBPATH, uuid+".db"))
 	if err != nil {
@@ -278,13 +398,210 @@ func CreateSendFile(uuid string) (*os.File, error) {
 		os.Remove(storePath)
 		return nil, err
 	}
-	filePath, err := xdg.Cache.Ensure(path.Join(SUBPATH, uuid+".m-send.req"))
+	filePath, err := xdg.Data.Ensure(path.Join(SUBPATH, uuid+".m-send.req"))
 	if err != nil {
 		return nil, err
 	}
 	return os.Create(filePath)
 }
 
+// Returns .m-send.req file path to the outgoing message identified by uuid.
+// If file doesn't exists, a non nil error is returned.
+func GetSendFile(uuid string) (string, error) {
+	return xdg.Data.Find(path.Join(SUBPATH, uuid+".m-send.req"))
+}
+
+// Increments the number of failed attempts of the stored message (identified by uuid) and sets when it is attempted next.
+// Returns the stored message state and a nil error on success.
+// If message not in storage or other error occurs, it returns empty or previous state and a non nil error.
+func UpdateAttempt(uuid string, nextAttempt time.Time) (MMSState, error) {
+	oldState, err := GetMMSState(uuid)
+	if err != nil {
+		return oldState, fmt.Errorf("error retrieving message state: %w", err)
+	}
+
+	newState := oldState
+	newState.Attempts++
+	newState.NextAttempt = nextAttempt
+
+	storePath, err := xdg.Data.Find(path.Join(SUBPATH, uuid+".db"))
+	if err != nil {
+		return oldState, err
+	}
+	if err := writeState(newState, storePath); err != nil {
+		return oldState, err
+	}
+
+	return newState, nil
+}
+
+// Stores the response status and text of the m-send.conf received for the stored outgoing message identified by uuid.
+// Returns the stored message state and a nil error on success.
+// If message not in storage or other error occurs, it returns empty or previous state and a non nil error.
+func UpdateResponse(uuid string, responseStatus byte, responseText string) (MMSState, error) {
+	oldState, err := GetMMSState(uuid)
+	if err != nil {
+		return oldState, fmt.Errorf("error retrieving message state: %w", err)
+	}
+
+	newState := oldState
+	newState.ResponseStatus = responseStatus
+	newState.ResponseText = responseText
+
+	storePath, err := xdg.Data.Find(path.Join(SUBPATH, uuid+".db"))
+	if err != nil {
+		return oldState, err
+	}
+	if err := writeState(newState, storePath); err != nil {
+		return oldState, err
+	}
+
+	return newState, nil
+}
+
+// Sets the number of failed attempts of the stored message (identified by uuid), with no next attempt scheduled.
+// Returns the stored message state and a nil error on success.
+// If message not in storage or other error occurs, it returns empty or previous state and a non nil error.
+func SetAttempts(uuid string, attempts int) (MMSState, error) {
+	oldState, err := GetMMSState(uuid)
+	if err != nil {
+		return oldState, fmt.Errorf("error retrieving message state: %w", err)
+	}
+
+	newState := oldState
+	newState.Attempts = attempts
+	newState.NextAttempt = time.Time{}
+
+	storePath, err := xdg.Data.Find(path.Join(SUBPATH, uuid+".db"))
+	if err != nil {
+		return oldState, err
+	}
+	if err := writeState(newState, storePath); err != nil {
+		return oldState, err
+	}
+
+	return newState, nil
+}
+
+// Updates the stored message (identified by uuid) state to SENT and stores the messageId assigned by the MMS center.
+// The message is indexed by messageId for GetSentUUID.
+// Returns the stored message state and a nil error on success.
+// If message not in storage or other error occurs, it returns empty or previous state and a non nil error.
+func UpdateSent(uuid, messageId string) (MMSState, error) {
+	oldState, err := GetMMSState(uuid)
+	if err != nil {
+		return oldState, fmt.Errorf("error retrieving message state: %w", err)
+	}
+
+	newState := oldState
+	newState.State = SENT
+	newState.Id = messageId
+	newState.Sent = time.Now()
+
+	storePath, err := xdg.Data.Find(path.Join(SUBPATH, uuid+".db"))
+	if err != nil {
+		return oldState, err
+	}
+	if err := writeState(newState, storePath); err != nil {
+		return oldState, err
+	}
+
+	if messageId != "" {
+		indexPath, err := xdg.Data.Ensure(sentIndexPath(messageId))
+		if err != nil {
+			return newState, err
+		}
+		if err := ioutil.WriteFile(indexPath, []byte(uuid), 0600); err != nil {
+			return newState, err
+		}
+	}
+
+	return newState, nil
+}
+
+// Updates the SendState of recipient to status for the stored sent message identified by uuid.
+// Returns the stored message state and a nil error on success.
+// If message not in storage, is not a sent message or other error occurs, it returns empty or previous state and a non nil error.
+func UpdateSendState(uuid, recipient, status string) (MMSState, error) {
+	oldState, err := GetMMSState(uuid)
+	if err != nil {
+		return oldState, fmt.Errorf("error retrieving message state: %w", err)
+	}
+	if oldState.State != SENT {
+		return oldState, fmt.Errorf("message state is %s, expected %s", oldState.State, SENT)
+	}
+
+	newState := oldState
+	newState.SendState = make(SendInfo, len(oldState.SendState)+1)
+	for k, v := range oldState.SendState {
+		newState.SendState[k] = v
+	}
+	newState.SendState[recipient] = status
+
+	storePath, err := xdg.Data.Find(path.Join(SUBPATH, uuid+".db"))
+	if err != nil {
+		return oldState, err
+	}
+	if err := writeState(newState, storePath); err != nil {
+		return oldState, err
+	}
+
+	return newState, nil
+}
+
+// Returns the UUID of the stored sent message, which was assigned messageId by the MMS center.
+// If no such message is stored, a non nil error is returned.
+func GetSentUUID(messageId string) (string, error) {
+	if messageId == "" {
+		return "", fmt.Errorf("empty message id")
+	}
+	notFound := fmt.Errorf("no sent message with message id %s", messageId)
+	indexPath, err := xdg.Data.Find(sentIndexPath(messageId))
+	if err != nil {
+		return "", notFound
+	}
+	data, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return "", err
+	}
+	uuid := string(data)
+	if mmsState, err := GetMMSState(uuid); err != nil || mmsState.State != SENT || mmsState.Id != messageId {
+		return "", notFound
+	}
+	return uuid, nil
+}
+
+// sentIndexPath returns the path, relative to the xdg data directory, of the file holding the uuid of the
+// sent message which was assigned messageId. The message id is hashed, as it can hold any characters.
+func sentIndexPath(messageId string) string {
+	sum := sha1.Sum([]byte(messageId))
+	return path.Join(SUBPATH, "sent", hex.EncodeToString(sum[:]))
+}
+
+// Updates the pending read report of stored message identified by uuid.
+// Use nil mReadRecInd to clear the pending read report (e.g. after it was sent).
+// Returns the stored message state and a nil error on success.
+// If message not in storage or other error occurs, it returns empty or previous state and a non nil error.
+func UpdateMReadRecInd(uuid string, mReadRecInd *mms.MReadRecInd) (MMSState, error) {
+	oldState, err := GetMMSState(uuid)
+	if err != nil {
+		return oldState, fmt.Errorf("error retrieving message state: %w", err)
+	}
+
+	newState := oldState
+	newState.MReadRecInd = mReadRecInd
+
+	storePath, err := xdg.Data.Find(path.Join(SUBPATH, uuid+".db"))
+	if err != nil {
+		return oldState, err
+	}
+	if err := writeState(newState, storePath); err != nil {
+		return oldState, err
+	}
+
+	return newState, nil
+}
+
 // Returns .mms file path to message identified by uuid.
 // If file doesn't exists, a non nil error is returned.
 func GetMMS(uuid string) (string, error) {
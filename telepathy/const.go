@@ -21,6 +21,8 @@
 
 package telepathy
 
+import "time"
+
 const (
 	MMS_DBUS_NAME          = "org.ofono.mms"
 	MMS_DBUS_PATH          = "/org/ofono/mms"
@@ -32,6 +34,11 @@ const (
 const (
 	identityProperty           string = "Identity"
 	useDeliveryReportsProperty string = "UseDeliveryReports"
+	useReadReportsProperty     string = "UseReadReports"
+	deferredDownloadProperty   string = "DeferredDownload"
+	generateSmilProperty       string = "GenerateSmil"
+	maxMessageSizeProperty     string = "MaxMessageSize"
+	stripMetadataProperty      string = "StripMetadata"
 	modemObjectPathProperty    string = "ModemObjectPath"
 	messageAddedSignal         string = "MessageAdded"
 	messageRemovedSignal       string = "MessageRemoved"
@@ -40,14 +47,26 @@ const (
 	preferredContextProperty   string = "PreferredContext"
 	propertyChangedSignal      string = "PropertyChanged"
 	statusProperty             string = "Status"
+	deliveryReportProperty     string = "DeliveryReport"
+	errorProperty              string = "Error"
+	messageIdProperty          string = "MessageId"
+	responseStatusProperty     string = "ResponseStatus"
+	responseTextProperty       string = "ResponseText"
+	recipientStatusProperty    string = "RecipientStatus"
+	transferredBytesProperty   string = "TransferredBytes"
+	totalBytesProperty         string = "TotalBytes"
 )
 
+// defaultMaxMessageSize is the maximum size of outgoing messages most carriers accept.
+const defaultMaxMessageSize uint32 = 300 * 1024
+
+// progressInterval is the minimal interval between two signalled transfer progress changes of a message.
+const progressInterval = 500 * time.Millisecond
+
 const (
 	PERMANENT_ERROR = "PermanentError"
 	SENT            = "Sent"
+	READ            = "Read"
 	TRANSIENT_ERROR = "TransientError"
-)
-
-const (
-	PLMN = "/TYPE=PLMN"
+	CANCELLED       = "Cancelled"
 )
@@ -45,3 +45,20 @@ func (m Message) IsNew() (bool, error) {
 
 	return newEvent, nil
 }
+
+func (m Message) EventId() (string, error) {
+	if !m.Exists() {
+		return "", ErrorNonExistentMessage
+	}
+	v, ok := m["eventId"]
+	if !ok {
+		return "", ErrorMessagePropertyMissing("eventId")
+	}
+
+	eventId, ok := v.Value.(string)
+	if !ok {
+		return "", ErrorMessagePropertyType{"eventId", "", v.Value}
+	}
+
+	return eventId, nil
+}
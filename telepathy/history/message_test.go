@@ -52,3 +52,25 @@ func TestMessage_IsNew(t *testing.T) {
 		})
 	}
 }
+
+func TestMessage_EventId(t *testing.T) {
+	testCases := []struct {
+		name string
+		m    Message
+		want string
+		err  error
+	}{
+		{"nil", Message(nil), "", ErrorNonExistentMessage},
+		{"empty", Message{}, "", ErrorMessagePropertyMissing("eventId")},
+		{"wrong type int", Message{"eventId": dbus.Variant{10}}, "", ErrorMessagePropertyType{"eventId", "", 10}},
+		{"path", Message{"eventId": dbus.Variant{"/org/ofono/mms/1234/abcd"}}, "/org/ofono/mms/1234/abcd", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventId, err := tc.m.EventId()
+			if eventId != tc.want || !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("%#v.EventId() = %v, %#v, want %v, %#v", tc.m, eventId, err, tc.want, tc.err)
+			}
+		})
+	}
+}
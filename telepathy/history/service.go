@@ -39,6 +39,40 @@ func (service *HistoryService) GetSingleMessage(accountId, threadId, eventId str
 
 var ErrorNilHistoryService = fmt.Errorf("nil HistoryService pointer")
 
+// Watches the EventsModified signal of HistoryService and sends every modified message (e.g. marked as read) to the returned channel.
+// The returned channel is closed when the watch is canceled.
+func (service *HistoryService) WatchEventsModified() (*dbus.SignalWatch, <-chan Message, error) {
+	if service == nil {
+		return nil, nil, ErrorNilHistoryService
+	}
+
+	watch, err := service.conn.WatchSignal(&dbus.MatchRule{
+		Type:      dbus.TypeSignal,
+		Interface: "com.canonical.HistoryService",
+		Member:    "EventsModified",
+		Path:      "/com/canonical/HistoryService",
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("EventsModified watch error: %w", err)
+	}
+
+	msgs := make(chan Message)
+	go func() {
+		defer close(msgs)
+		for signal := range watch.C {
+			events := []map[string]dbus.Variant(nil)
+			if err := signal.Args(&events); err != nil {
+				log.Printf("HistoryService.WatchEventsModified: signal arguments error: %v", err)
+				continue
+			}
+			for _, event := range events {
+				msgs <- Message(event)
+			}
+		}
+	}()
+	return watch, msgs, nil
+}
+
 // Returns first message identified by eventId from HistoryService.
 func (service *HistoryService) GetMessage(eventId string) (Message, error) {
 	if service == nil {
@@ -93,13 +93,13 @@ func (manager *MMSManager) serviceAdded(payload *Payload) error {
 	return nil
 }
 
-func (manager *MMSManager) AddService(identity string, modemObjPath dbus.ObjectPath, outgoingChannel chan *OutgoingMessage, useDeliveryReports bool, mNotificationIndChan chan<- *mms.MNotificationInd) (*MMSService, error) {
+func (manager *MMSManager) AddService(identity string, modemObjPath dbus.ObjectPath, outgoingChannel chan *OutgoingMessage, useDeliveryReports bool, mNotificationIndChan chan<- *mms.MNotificationInd, mReadRecIndChan chan<- *mms.MReadRecInd, sendCancelChan chan<- string, downloadCancelChan chan<- string) (*MMSService, error) {
 	for i := range manager.services {
 		if manager.services[i].isService(identity) {
 			return manager.services[i], nil
 		}
 	}
-	service := NewMMSService(manager.conn, modemObjPath, identity, outgoingChannel, useDeliveryReports, mNotificationIndChan)
+	service := NewMMSService(manager.conn, modemObjPath, identity, outgoingChannel, useDeliveryReports, mNotificationIndChan, mReadRecIndChan, sendCancelChan, downloadCancelChan)
 	if err := manager.serviceAdded(&service.payload); err != nil {
 		return &MMSService{}, err
 	}
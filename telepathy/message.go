@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"sync"
 
 	"launchpad.net/go-dbus/v1"
 )
@@ -32,7 +33,7 @@ import (
 var validStatus sort.StringSlice
 
 func init() {
-	validStatus = sort.StringSlice{SENT, PERMANENT_ERROR, TRANSIENT_ERROR}
+	validStatus = sort.StringSlice{SENT, READ, PERMANENT_ERROR, TRANSIENT_ERROR, CANCELLED}
 	sort.Strings(validStatus)
 }
 
@@ -42,15 +43,19 @@ type MessageInterface struct {
 	msgChan        chan *dbus.Message
 	deleteChan     chan dbus.ObjectPath
 	redownloadChan chan dbus.ObjectPath
+	cancelChan     chan dbus.ObjectPath
+	lock           sync.Mutex
 	status         string
+	error          string
 }
 
-func NewMessageInterface(conn *dbus.Connection, objectPath dbus.ObjectPath, deleteChan chan dbus.ObjectPath, redownloadChan chan dbus.ObjectPath) *MessageInterface {
+func NewMessageInterface(conn *dbus.Connection, objectPath dbus.ObjectPath, deleteChan chan dbus.ObjectPath, redownloadChan chan dbus.ObjectPath, cancelChan chan dbus.ObjectPath) *MessageInterface {
 	msgInterface := MessageInterface{
 		conn:           conn,
 		objectPath:     objectPath,
 		deleteChan:     deleteChan,
 		redownloadChan: redownloadChan,
+		cancelChan:     cancelChan,
 		msgChan:        make(chan *dbus.Message),
 		status:         "draft",
 	}
@@ -93,17 +98,29 @@ func (msgInterface *MessageInterface) watchDBusMethodCalls() {
 				continue
 			}
 			msgInterface.deleteChan <- msgInterface.objectPath
-		case "Redownload":
+		case "Redownload", "Download":
+			// Download starts a deferred download, Redownload retries a failed one. Both are handled the same way.
 			reply = dbus.NewMethodReturnMessage(msg)
 			//TODO implement store and forward
 			if err := msgInterface.conn.Send(reply); err != nil {
 				log.Println("Could not send reply:", err)
 			}
 			if msgInterface.redownloadChan == nil {
-				log.Printf("Redownload of %s is not allowed", msg.Path)
+				log.Printf("%s of %s is not allowed", msg.Member, msg.Path)
 				continue
 			}
 			msgInterface.redownloadChan <- msgInterface.objectPath
+		case "Cancel":
+			// Cancel aborts the download in progress.
+			reply = dbus.NewMethodReturnMessage(msg)
+			if err := msgInterface.conn.Send(reply); err != nil {
+				log.Println("Could not send reply:", err)
+			}
+			if msgInterface.cancelChan == nil {
+				log.Printf("Cancel of %s is not allowed", msg.Path)
+				continue
+			}
+			msgInterface.cancelChan <- msgInterface.objectPath
 		default:
 			log.Println("Received unknown method call on", msg.Interface, msg.Member)
 			reply = dbus.NewErrorMessage(
@@ -121,7 +138,9 @@ func (msgInterface *MessageInterface) watchDBusMethodCalls() {
 func (msgInterface *MessageInterface) StatusChanged(status string) error {
 	i := validStatus.Search(status)
 	if i < validStatus.Len() && validStatus[i] == status {
+		msgInterface.lock.Lock()
 		msgInterface.status = status
+		msgInterface.lock.Unlock()
 		signal := dbus.NewSignalMessage(msgInterface.objectPath, MMS_MESSAGE_DBUS_IFACE, propertyChangedSignal)
 		if err := signal.AppendArgs(statusProperty, dbus.Variant{status}); err != nil {
 			return err
@@ -135,9 +154,58 @@ func (msgInterface *MessageInterface) StatusChanged(status string) error {
 	return fmt.Errorf("status %s is not a valid status", status)
 }
 
+// ErrorChanged sets the Error property, a json object describing why the message failed.
+func (msgInterface *MessageInterface) ErrorChanged(errorMessage string) error {
+	msgInterface.lock.Lock()
+	msgInterface.error = errorMessage
+	msgInterface.lock.Unlock()
+	return messagePropertyChanged(msgInterface.conn, msgInterface.objectPath, errorProperty, errorMessage)
+}
+
+// ResponseChanged signals the MessageId, ResponseStatus and ResponseText properties from the m-send.conf
+// the MMS center answered the outgoing message with. The MessageId is only signalled if one was assigned.
+func (msgInterface *MessageInterface) ResponseChanged(messageId string, responseStatus byte, responseText string) error {
+	if messageId != "" {
+		if err := messagePropertyChanged(msgInterface.conn, msgInterface.objectPath, messageIdProperty, messageId); err != nil {
+			return err
+		}
+	}
+	if err := messagePropertyChanged(msgInterface.conn, msgInterface.objectPath, responseStatusProperty, responseStatus); err != nil {
+		return err
+	}
+	return messagePropertyChanged(msgInterface.conn, msgInterface.objectPath, responseTextProperty, responseText)
+}
+
+// RecipientStatusChanged signals the RecipientStatus property, the delivery status of each recipient.
+func (msgInterface *MessageInterface) RecipientStatusChanged(recipientStatus map[string]string) error {
+	return messagePropertyChanged(msgInterface.conn, msgInterface.objectPath, recipientStatusProperty, recipientStatus)
+}
+
+// ProgressChanged signals the TransferredBytes and TotalBytes properties, the progress of transferring the message.
+func (msgInterface *MessageInterface) ProgressChanged(transferred, total uint64) error {
+	if err := messagePropertyChanged(msgInterface.conn, msgInterface.objectPath, transferredBytesProperty, transferred); err != nil {
+		return err
+	}
+	return messagePropertyChanged(msgInterface.conn, msgInterface.objectPath, totalBytesProperty, total)
+}
+
+// messagePropertyChanged emits the PropertyChanged signal for the message on objectPath.
+func messagePropertyChanged(conn *dbus.Connection, objectPath dbus.ObjectPath, propertyName string, value interface{}) error {
+	signal := dbus.NewSignalMessage(objectPath, MMS_MESSAGE_DBUS_IFACE, propertyChangedSignal)
+	if err := signal.AppendArgs(propertyName, dbus.Variant{value}); err != nil {
+		return err
+	}
+	return conn.Send(signal)
+}
+
 func (msgInterface *MessageInterface) GetPayload() *Payload {
+	msgInterface.lock.Lock()
+	defer msgInterface.lock.Unlock()
 	properties := make(map[string]dbus.Variant)
 	properties["Status"] = dbus.Variant{msgInterface.status}
+	if msgInterface.error != "" {
+		properties[errorProperty] = dbus.Variant{msgInterface.error}
+	}
 	return &Payload{
 		Path:       msgInterface.objectPath,
 		Properties: properties,
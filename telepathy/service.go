@@ -26,9 +26,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ubports/nuntium/mms"
@@ -46,15 +48,22 @@ type Payload struct {
 
 type MMSService struct {
 	payload              Payload
+	propertiesLock       sync.RWMutex
 	Properties           map[string]dbus.Variant
 	conn                 *dbus.Connection
 	msgChan              chan *dbus.Message
+	handlersLock         sync.RWMutex
 	messageHandlers      map[dbus.ObjectPath]*MessageInterface
 	msgDeleteChan        chan dbus.ObjectPath
 	msgRedownloadChan    chan dbus.ObjectPath
 	identity             string
 	outMessage           chan *OutgoingMessage
 	mNotificationIndChan chan<- *mms.MNotificationInd
+	mReadRecIndChan      chan<- *mms.MReadRecInd
+	sendCancelChan       chan<- string
+	msgCancelChan        chan dbus.ObjectPath
+	downloadCancelChan   chan<- string
+	historyWatch         *dbus.SignalWatch
 }
 
 type Attachment struct {
@@ -72,16 +81,25 @@ type OutAttachment struct {
 }
 
 type OutgoingMessage struct {
-	Recipients  []string
-	Attachments []OutAttachment
-	Reply       *dbus.Message
+	Recipients           []string
+	Cc, Bcc              []string
+	Subject              string
+	Priority             byte
+	Expiry, DeliveryTime mms.TimeValue
+	Attachments          []OutAttachment
+	Reply                *dbus.Message
 }
 
-func NewMMSService(conn *dbus.Connection, modemObjPath dbus.ObjectPath, identity string, outgoingChannel chan *OutgoingMessage, useDeliveryReports bool, mNotificationIndChan chan<- *mms.MNotificationInd) *MMSService {
+func NewMMSService(conn *dbus.Connection, modemObjPath dbus.ObjectPath, identity string, outgoingChannel chan *OutgoingMessage, useDeliveryReports bool, mNotificationIndChan chan<- *mms.MNotificationInd, mReadRecIndChan chan<- *mms.MReadRecInd, sendCancelChan chan<- string, downloadCancelChan chan<- string) *MMSService {
 	properties := make(map[string]dbus.Variant)
 	properties[identityProperty] = dbus.Variant{identity}
 	serviceProperties := make(map[string]dbus.Variant)
 	serviceProperties[useDeliveryReportsProperty] = dbus.Variant{useDeliveryReports}
+	serviceProperties[useReadReportsProperty] = dbus.Variant{false}
+	serviceProperties[deferredDownloadProperty] = dbus.Variant{false}
+	serviceProperties[generateSmilProperty] = dbus.Variant{true}
+	serviceProperties[maxMessageSizeProperty] = dbus.Variant{defaultMaxMessageSize}
+	serviceProperties[stripMetadataProperty] = dbus.Variant{true}
 	serviceProperties[modemObjectPathProperty] = dbus.Variant{modemObjPath}
 	payload := Payload{
 		Path:       dbus.ObjectPath(MMS_DBUS_PATH + "/" + identity),
@@ -98,10 +116,22 @@ func NewMMSService(conn *dbus.Connection, modemObjPath dbus.ObjectPath, identity
 		outMessage:           outgoingChannel,
 		identity:             identity,
 		mNotificationIndChan: mNotificationIndChan,
+		mReadRecIndChan:      mReadRecIndChan,
+		sendCancelChan:       sendCancelChan,
+		msgCancelChan:        make(chan dbus.ObjectPath),
+		downloadCancelChan:   downloadCancelChan,
 	}
+	service.loadSettings()
 	go service.watchDBusMethodCalls()
 	go service.watchMessageDeleteCalls()
 	go service.watchMessageRedownloadCalls()
+	go service.watchMessageCancelCalls()
+	if watch, events, err := service.HistoryService().WatchEventsModified(); err != nil {
+		log.Printf("Unable to watch HistoryService events, read reports won't be sent: %v", err)
+	} else {
+		service.historyWatch = watch
+		go service.watchHistoryEvents(events)
+	}
 	conn.RegisterObjectPath(payload.Path, service.msgChan)
 	return &service
 }
@@ -117,11 +147,30 @@ func (*MMSService) getMMSState(objectPath dbus.ObjectPath) (storage.MMSState, er
 
 func (service *MMSService) watchMessageDeleteCalls() {
 	for msgObjectPath := range service.msgDeleteChan {
-		if mmsState, err := service.getMMSState(msgObjectPath); err == nil {
-			if mmsState.State != storage.RESPONDED && mmsState.MNotificationInd != nil && !mmsState.MNotificationInd.Expired() {
-				log.Printf("Message %s is not responded and not expired, not deleting.", string(msgObjectPath))
+		mmsState, err := service.getMMSState(msgObjectPath)
+		if err != nil || mmsState.State == storage.DRAFT {
+			// Outgoing messages are stored as drafts until sent, or not stored yet while queued.
+			// Their sending is cancelled and they are removed by the mediator.
+			uuid, err := getUUIDFromObjectPath(msgObjectPath)
+			if err != nil {
+				log.Print("Failed to cancel ", msgObjectPath, ": ", err)
 				continue
 			}
+			service.sendCancelChan <- uuid
+			continue
+		}
+		if mmsState.State != storage.RESPONDED && mmsState.MNotificationInd != nil && !mmsState.MNotificationInd.Deferred && !mmsState.MNotificationInd.Expired() {
+			log.Printf("Message %s is not responded and not expired, not deleting.", string(msgObjectPath))
+			continue
+		}
+
+		// The pending read report would get lost with the message, send it now if message was read.
+		if mmsState.MReadRecInd != nil {
+			if hsMessage, err := service.HistoryService().GetMessage(string(msgObjectPath)); err != nil {
+				log.Printf("Error getting message %s from HistoryService: %v", string(msgObjectPath), err)
+			} else if isnew, err := hsMessage.IsNew(); err == nil && !isnew {
+				service.reportRead(msgObjectPath)
+			}
 		}
 
 		if err := service.MessageRemoved(msgObjectPath); err != nil {
@@ -130,6 +179,42 @@ func (service *MMSService) watchMessageDeleteCalls() {
 	}
 }
 
+// watchHistoryEvents reports handled messages, which were marked as read in HistoryService.
+func (service *MMSService) watchHistoryEvents(events <-chan history.Message) {
+	for hsMessage := range events {
+		if isnew, err := hsMessage.IsNew(); err != nil || isnew {
+			continue
+		}
+		eventId, err := hsMessage.EventId()
+		if err != nil {
+			continue
+		}
+		msgObjectPath := dbus.ObjectPath(eventId)
+		if _, ok := service.getMessageHandler(msgObjectPath); !ok {
+			continue
+		}
+		service.reportRead(msgObjectPath)
+	}
+}
+
+// reportRead hands the pending read report of message identified by msgObjectPath to be sent and clears it in storage.
+func (service *MMSService) reportRead(msgObjectPath dbus.ObjectPath) {
+	mmsState, err := service.getMMSState(msgObjectPath)
+	if err != nil {
+		log.Printf("Read report of %s error: retrieving message state error: %v", string(msgObjectPath), err)
+		return
+	}
+	if mmsState.MReadRecInd == nil {
+		return
+	}
+
+	if _, err := storage.UpdateMReadRecInd(mmsState.MReadRecInd.UUID, nil); err != nil {
+		log.Printf("Read report of %s error: updating storage error: %v", string(msgObjectPath), err)
+		return
+	}
+	service.mReadRecIndChan <- mmsState.MReadRecInd
+}
+
 func (service *MMSService) watchMessageRedownloadCalls() {
 	for msgObjectPath := range service.msgRedownloadChan {
 		mmsState, err := service.getMMSState(msgObjectPath)
@@ -146,20 +231,43 @@ func (service *MMSService) watchMessageRedownloadCalls() {
 			continue
 		}
 
-		// Stop previous message handling, remove and notify.
-		if err := service.MessageRemoved(msgObjectPath); err != nil {
+		// Keep the content downloaded so far, to resume the download.
+		newUUID := mms.GenUUID()
+		if err := storage.MovePartialDownload(mmsState.MNotificationInd.UUID, newUUID); err != nil {
+			log.Printf("Redownload of %s warning: moving partial download error: %v", string(msgObjectPath), err)
+		}
+
+		// Stop previous message handling and remove it from storage. The message object stays, to be able to
+		// cancel the redownload on it, until RedownloadEnded notifies it was removed.
+		service.redownloadStarted(msgObjectPath)
+		if err := storage.Destroy(mmsState.MNotificationInd.UUID); err != nil {
 			log.Printf("Redownload of %s warning: removing message error: %v", string(msgObjectPath), err)
 		}
 
 		// Start new mNotificationInd handling as if pushed from MMS service, but with info about redownload.
 		newMNotificationInd := mmsState.MNotificationInd
 		newMNotificationInd.RedownloadOfUUID = mmsState.MNotificationInd.UUID
-		newMNotificationInd.UUID = mms.GenUUID()
+		newMNotificationInd.UUID = newUUID
 		storage.Create(mmsState.ModemId, newMNotificationInd)
+		// Keep counting the attempts to download, automatic retries stop after too many of them.
+		if _, err := storage.SetAttempts(newMNotificationInd.UUID, mmsState.Attempts); err != nil {
+			log.Printf("Redownload of %s warning: storing attempts error: %v", string(msgObjectPath), err)
+		}
 		service.mNotificationIndChan <- newMNotificationInd
 	}
 }
 
+func (service *MMSService) watchMessageCancelCalls() {
+	for msgObjectPath := range service.msgCancelChan {
+		uuid, err := getUUIDFromObjectPath(msgObjectPath)
+		if err != nil {
+			log.Print("Failed to cancel ", msgObjectPath, ": ", err)
+			continue
+		}
+		service.downloadCancelChan <- uuid
+	}
+}
+
 func (service *MMSService) watchDBusMethodCalls() {
 	for msg := range service.msgChan {
 		var reply *dbus.Message
@@ -190,12 +298,12 @@ func (service *MMSService) watchDBusMethodCalls() {
 		case "GetProperties":
 			reply = dbus.NewMethodReturnMessage(msg)
 			if pc, err := service.GetPreferredContext(); err == nil {
-				service.Properties[preferredContextProperty] = dbus.Variant{pc}
+				service.setPropertyValue(preferredContextProperty, pc)
 			} else {
 				// Using "/" as an invalid 'path' even though it could be considered 'incorrect'
-				service.Properties[preferredContextProperty] = dbus.Variant{dbus.ObjectPath("/")}
+				service.setPropertyValue(preferredContextProperty, dbus.ObjectPath("/"))
 			}
-			if err := reply.AppendArgs(service.Properties); err != nil {
+			if err := reply.AppendArgs(service.properties()); err != nil {
 				log.Print("Cannot parse payload data from services")
 				reply = dbus.NewErrorMessage(msg, "Error.InvalidArguments", "Cannot parse services")
 			}
@@ -215,8 +323,8 @@ func (service *MMSService) watchDBusMethodCalls() {
 		case "SendMessage":
 			var outMessage OutgoingMessage
 			outMessage.Reply = dbus.NewMethodReturnMessage(msg)
-			if err := msg.Args(&outMessage.Recipients, &outMessage.Attachments); err != nil {
-				log.Print("Cannot parse payload data from services")
+			if err := parseOutgoingMessage(msg, &outMessage); err != nil {
+				log.Print("Cannot parse payload data from services: ", err)
 				reply = dbus.NewErrorMessage(msg, "Error.InvalidArguments", "Cannot parse New Message")
 				if err := service.conn.Send(reply); err != nil {
 					log.Println("Could not send reply:", err)
@@ -238,6 +346,125 @@ func (service *MMSService) watchDBusMethodCalls() {
 	}
 }
 
+// parseOutgoingMessage reads the SendMessage arguments into outMessage. These
+// are the recipients and the attachments, optionally followed by a dictionary
+// of options:
+//
+//	Cc (array of strings): numbers to send a copy of the message to
+//	Bcc (array of strings): numbers to send a blind copy of the message to
+//	Subject (string): subject of the message
+//	Priority (string): "low", "normal" or "high"
+//	Expiry (string or integer): RFC 3339 date or seconds until the message expires
+//	DeliveryTime (string or integer): RFC 3339 date or seconds until the message is delivered
+func parseOutgoingMessage(msg *dbus.Message, outMessage *OutgoingMessage) error {
+	var options map[string]dbus.Variant
+	if err := msg.Args(&outMessage.Recipients, &outMessage.Attachments, &options); err != nil {
+		// Callers not knowing about the options don't send them.
+		options = nil
+		if err := msg.Args(&outMessage.Recipients, &outMessage.Attachments); err != nil {
+			return err
+		}
+	}
+	for name, value := range options {
+		var err error
+		switch name {
+		case "Cc":
+			outMessage.Cc, err = stringsOption(name, value)
+		case "Bcc":
+			outMessage.Bcc, err = stringsOption(name, value)
+		case "Subject":
+			var ok bool
+			if outMessage.Subject, ok = value.Value.(string); !ok {
+				err = fmt.Errorf("option %s has to be a string", name)
+			}
+		case "Priority":
+			outMessage.Priority, err = priorityOption(name, value)
+		case "Expiry":
+			outMessage.Expiry, err = timeOption(name, value)
+		case "DeliveryTime":
+			outMessage.DeliveryTime, err = timeOption(name, value)
+		default:
+			log.Printf("Ignoring unknown SendMessage option %s", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stringsOption(name string, value dbus.Variant) ([]string, error) {
+	switch v := value.Value.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		strs := make([]string, len(v))
+		for i := range v {
+			s, ok := v[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("option %s has to be an array of strings", name)
+			}
+			strs[i] = s
+		}
+		return strs, nil
+	}
+	return nil, fmt.Errorf("option %s has to be an array of strings", name)
+}
+
+func priorityOption(name string, value dbus.Variant) (byte, error) {
+	if v, ok := value.Value.(string); ok {
+		switch strings.ToLower(v) {
+		case "low":
+			return mms.PriorityLow, nil
+		case "normal":
+			return mms.PriorityNormal, nil
+		case "high":
+			return mms.PriorityHigh, nil
+		}
+	}
+	return 0, fmt.Errorf("option %s has to be one of low, normal or high", name)
+}
+
+// maxRelativeSeconds is the longest relative time a time.Duration can hold.
+const maxRelativeSeconds = int64(1<<63-1) / int64(time.Second)
+
+// timeOption reads an RFC 3339 date as an absolute time and a number of
+// seconds as a time relative to when the message is sent.
+func timeOption(name string, value dbus.Variant) (mms.TimeValue, error) {
+	var seconds int64
+	switch v := value.Value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return mms.TimeValue{}, fmt.Errorf("option %s is not an RFC 3339 date: %s", name, err)
+		}
+		if !t.After(time.Now()) {
+			return mms.TimeValue{}, fmt.Errorf("option %s has to be a date in the future", name)
+		}
+		return mms.AbsoluteTime(t), nil
+	case int32:
+		seconds = int64(v)
+	case uint32:
+		seconds = int64(v)
+	case int64:
+		seconds = v
+	case uint64:
+		if v > uint64(maxRelativeSeconds) {
+			return mms.TimeValue{}, fmt.Errorf("option %s has to be at most %d seconds", name, maxRelativeSeconds)
+		}
+		seconds = int64(v)
+	default:
+		return mms.TimeValue{}, fmt.Errorf("option %s has to be a date or a number of seconds", name)
+	}
+	if seconds <= 0 {
+		return mms.TimeValue{}, fmt.Errorf("option %s has to be a positive number of seconds", name)
+	}
+	if seconds > maxRelativeSeconds {
+		return mms.TimeValue{}, fmt.Errorf("option %s has to be at most %d seconds", name, maxRelativeSeconds)
+	}
+	return mms.RelativeTime(time.Duration(seconds) * time.Second), nil
+}
+
 func getUUIDFromObjectPath(objectPath dbus.ObjectPath) (string, error) {
 	str := string(objectPath)
 	defaultError := fmt.Errorf("%s is not a proper object path for a Message", str)
@@ -252,6 +479,9 @@ func getUUIDFromObjectPath(objectPath dbus.ObjectPath) (string, error) {
 }
 
 func (service *MMSService) SetPreferredContext(context dbus.ObjectPath) error {
+	if service == nil {
+		return ErrorNilMMSService
+	}
 	// make set a noop if we are setting the same thing
 	if pc, err := service.GetPreferredContext(); err != nil && context == pc {
 		return nil
@@ -268,9 +498,57 @@ func (service *MMSService) SetPreferredContext(context dbus.ObjectPath) error {
 }
 
 func (service *MMSService) GetPreferredContext() (dbus.ObjectPath, error) {
+	if service == nil {
+		return "", ErrorNilMMSService
+	}
 	return storage.GetPreferredContext(service.identity)
 }
 
+// Returns if read reports should be requested for outgoing messages and sent for incoming messages, if requested by originator.
+func (service *MMSService) UseReadReports() bool {
+	if service == nil {
+		return false
+	}
+	useReadReports, _ := service.propertyValue(useReadReportsProperty).(bool)
+	return useReadReports
+}
+
+// Returns if download of incoming messages should be deferred until requested by the Download method on the message.
+func (service *MMSService) DeferredDownload() bool {
+	if service == nil {
+		return false
+	}
+	deferredDownload, _ := service.propertyValue(deferredDownloadProperty).(bool)
+	return deferredDownload
+}
+
+// Returns if a SMIL presentation should be generated for outgoing messages without one.
+func (service *MMSService) GenerateSmil() bool {
+	if service == nil {
+		return true
+	}
+	generateSmil, _ := service.propertyValue(generateSmilProperty).(bool)
+	return generateSmil
+}
+
+// Returns if the EXIF, XMP and IPTC metadata should be removed from outgoing images.
+func (service *MMSService) StripMetadata() bool {
+	if service == nil {
+		return true
+	}
+	stripMetadata, _ := service.propertyValue(stripMetadataProperty).(bool)
+	return stripMetadata
+}
+
+// Returns the maximum size in bytes of outgoing messages the carrier accepts, 0 if there is no limit.
+func (service *MMSService) MaxMessageSize() uint64 {
+	if service == nil {
+		return uint64(defaultMaxMessageSize)
+	}
+	maxMessageSize, _ := service.propertyValue(maxMessageSizeProperty).(uint32)
+	return uint64(maxMessageSize)
+}
+
 func (service *MMSService) setProperty(msg *dbus.Message) error {
 	var propertyName string
 	var propertyValue dbus.Variant
@@ -281,14 +559,92 @@ func (service *MMSService) setProperty(msg *dbus.Message) error {
 	switch propertyName {
 	case preferredContextProperty:
 		preferredContextObjectPath := dbus.ObjectPath(reflect.ValueOf(propertyValue.Value).String())
-		service.Properties[preferredContextProperty] = dbus.Variant{preferredContextObjectPath}
+		service.setPropertyValue(preferredContextProperty, preferredContextObjectPath)
 		return service.SetPreferredContext(preferredContextObjectPath)
+	case useReadReportsProperty, deferredDownloadProperty, generateSmilProperty, stripMetadataProperty:
+		value, ok := propertyValue.Value.(bool)
+		if !ok {
+			return fmt.Errorf("property %s has to be a boolean", propertyName)
+		}
+		if err := storage.SetSetting(service.identity, propertyName, value); err != nil {
+			return err
+		}
+		return service.propertyChanged(propertyName, value)
+	case maxMessageSizeProperty:
+		value, ok := propertyValue.Value.(uint32)
+		if !ok {
+			return fmt.Errorf("property %s has to be an unsigned 32-bit integer", propertyName)
+		}
+		if err := storage.SetSetting(service.identity, propertyName, value); err != nil {
+			return err
+		}
+		return service.propertyChanged(propertyName, value)
 	default:
 		errors.New("property cannot be set")
 	}
 	return errors.New("unhandled property")
 }
 
+// loadSettings restores the properties set by clients, which were stored by setProperty.
+func (service *MMSService) loadSettings() {
+	settings, err := storage.GetSettings(service.identity)
+	if err != nil {
+		log.Printf("Cannot load settings of %s, using the defaults: %v", service.identity, err)
+		return
+	}
+	for name, value := range settings {
+		switch name {
+		case useReadReportsProperty, deferredDownloadProperty, generateSmilProperty, stripMetadataProperty:
+			if v, ok := value.(bool); ok {
+				service.setPropertyValue(name, v)
+				continue
+			}
+		case maxMessageSizeProperty:
+			// Numbers are stored as json numbers.
+			if v, ok := value.(float64); ok && v >= 0 && v <= math.MaxUint32 {
+				service.setPropertyValue(name, uint32(v))
+				continue
+			}
+		default:
+			log.Printf("Ignoring unknown setting %s of %s", name, service.identity)
+			continue
+		}
+		log.Printf("Ignoring setting %s of %s with invalid value %v", name, service.identity, value)
+	}
+}
+
+// properties returns a copy of the service properties, which may be changed while it is sent.
+func (service *MMSService) properties() map[string]dbus.Variant {
+	service.propertiesLock.RLock()
+	defer service.propertiesLock.RUnlock()
+	properties := make(map[string]dbus.Variant, len(service.Properties))
+	for name, value := range service.Properties {
+		properties[name] = value
+	}
+	return properties
+}
+
+func (service *MMSService) propertyValue(propertyName string) interface{} {
+	service.propertiesLock.RLock()
+	defer service.propertiesLock.RUnlock()
+	return service.Properties[propertyName].Value
+}
+
+func (service *MMSService) setPropertyValue(propertyName string, value interface{}) {
+	service.propertiesLock.Lock()
+	defer service.propertiesLock.Unlock()
+	service.Properties[propertyName] = dbus.Variant{value}
+}
+
+func (service *MMSService) propertyChanged(propertyName string, value interface{}) error {
+	service.setPropertyValue(propertyName, value)
+	signal := dbus.NewSignalMessage(service.payload.Path, MMS_SERVICE_DBUS_IFACE, propertyChangedSignal)
+	if err := signal.AppendArgs(propertyName, dbus.Variant{value}); err != nil {
+		return err
+	}
+	return service.conn.Send(signal)
+}
+
 // MessageRemoved closes message handlers, removes message from storage and emits the MessageRemoved signal to mms service dbus interface for message identified by objectPath parameter in this order.
 // If message is not handled, removing from storage or sending signal fails, error is returned.
 func (service *MMSService) MessageRemoved(objectPath dbus.ObjectPath) error {
@@ -296,12 +652,11 @@ func (service *MMSService) MessageRemoved(objectPath dbus.ObjectPath) error {
 		return ErrorNilMMSService
 	}
 
-	if _, ok := service.messageHandlers[objectPath]; !ok {
+	msgInterface, ok := service.removeMessageHandler(objectPath)
+	if !ok {
 		return fmt.Errorf("message not handled")
 	}
-
-	service.messageHandlers[objectPath].Close()
-	delete(service.messageHandlers, objectPath)
+	msgInterface.Close()
 
 	uuid, err := getUUIDFromObjectPath(objectPath)
 	if err != nil {
@@ -345,12 +700,9 @@ func (service *MMSService) IncomingMessageFailAdded(mNotificationInd *mms.MNotif
 
 	params["Status"] = dbus.Variant{"received"}
 	params["Date"] = dbus.Variant{time.Now().Format(time.RFC3339)}
-	params["Sender"] = dbus.Variant{strings.TrimSuffix(mNotificationInd.From, PLMN)}
+	params["Sender"] = dbus.Variant{mms.DecodeAddress(mNotificationInd.From).Value}
 
-	errorCode := "x-ubports-nuntium-mms-error-unknown"
-	if eci, ok := downloadError.(interface{ Code() string }); ok {
-		errorCode = eci.Code()
-	}
+	errorCode := errorCode(downloadError)
 
 	allowRedownload := false
 	if ari, ok := downloadError.(interface{ AllowRedownload() bool }); ok {
@@ -394,12 +746,38 @@ func (service *MMSService) IncomingMessageFailAdded(mNotificationInd *mms.MNotif
 
 	payload := Payload{Path: service.GenMessagePath(mNotificationInd.UUID), Properties: params}
 
-	// Don't pass a redownload channel to NewMessageInterface if redownload not allowed.
+	// Don't pass a redownload channel to the message handler if redownload not allowed.
 	redownloadChan := service.msgRedownloadChan
 	if !allowRedownload {
 		redownloadChan = nil
 	}
-	service.messageHandlers[payload.Path] = NewMessageInterface(service.conn, payload.Path, service.msgDeleteChan, redownloadChan)
+	service.addMessageHandler(payload.Path, service.msgDeleteChan, redownloadChan, nil)
+	return service.MessageAdded(&payload)
+}
+
+// IncomingMessageDeferredAdded emits a MessageAdded with "deferred" status and the notification's size, subject and sender
+// for a message, which download was deferred, and creates an object path on the message interface.
+// The download can be started by calling the Download method on the message object path.
+func (service *MMSService) IncomingMessageDeferredAdded(mNotificationInd *mms.MNotificationInd) error {
+	if service == nil {
+		return ErrorNilMMSService
+	}
+
+	params := make(map[string]dbus.Variant)
+	params["Status"] = dbus.Variant{"deferred"}
+	params["Date"] = dbus.Variant{time.Now().Format(time.RFC3339)}
+	params["Sender"] = dbus.Variant{mms.DecodeAddress(mNotificationInd.From).Value}
+	params["Subject"] = dbus.Variant{mNotificationInd.Subject}
+	params["Size"] = dbus.Variant{mNotificationInd.Size}
+	if expire := mNotificationInd.Expire(); !expire.IsZero() {
+		params["Expire"] = dbus.Variant{expire.Format(time.RFC3339)}
+	}
+	if !mNotificationInd.Received.IsZero() {
+		params["Received"] = dbus.Variant{uint32(mNotificationInd.Received.Unix())}
+	}
+
+	payload := Payload{Path: service.GenMessagePath(mNotificationInd.UUID), Properties: params}
+	service.addMessageHandler(payload.Path, service.msgDeleteChan, service.msgRedownloadChan, nil)
 	return service.MessageAdded(&payload)
 }
 
@@ -428,7 +806,7 @@ func (service *MMSService) IncomingMessageAdded(mRetConf *mms.MRetrieveConf, mNo
 		payload.Properties["Received"] = dbus.Variant{mNotificationInd.Received.Unix()}
 	}
 
-	service.messageHandlers[payload.Path] = NewMessageInterface(service.conn, payload.Path, service.msgDeleteChan, nil)
+	service.addMessageHandler(payload.Path, service.msgDeleteChan, nil, nil)
 	return service.MessageAdded(&payload)
 }
 
@@ -442,14 +820,14 @@ func (service *MMSService) InitializationMessageAdded(mRetConf *mms.MRetrieveCon
 	}
 
 	path := service.GenMessagePath(mNotificationInd.UUID)
-	if _, ok := service.messageHandlers[path]; ok {
+	if _, ok := service.getMessageHandler(path); ok {
 		return fmt.Errorf("message is already handled")
 	}
 
 	// Initialization message only needs these properties to spawn proper handles in telepathy.
 	payload := Payload{Path: path, Properties: map[string]dbus.Variant{
 		"Status":  dbus.Variant{"received"},
-		"Sender":  dbus.Variant{strings.TrimSuffix(mNotificationInd.From, PLMN)},
+		"Sender":  dbus.Variant{mms.DecodeAddress(mNotificationInd.From).Value},
 		"Rescued": dbus.Variant{true},
 		"Silent":  dbus.Variant{true},
 	}}
@@ -468,10 +846,49 @@ func (service *MMSService) InitializationMessageAdded(mRetConf *mms.MRetrieveCon
 		}
 	}
 
-	service.messageHandlers[path] = NewMessageInterface(service.conn, path, service.msgDeleteChan, service.msgRedownloadChan)
+	service.addMessageHandler(path, service.msgDeleteChan, service.msgRedownloadChan, nil)
 	return service.MessageAdded(&payload)
 }
 
+// redownloadStarted replaces the handler of the message on msgObjectPath, which is redownloaded, by one allowing
+// only to cancel the redownload with the Cancel method.
+func (service *MMSService) redownloadStarted(msgObjectPath dbus.ObjectPath) {
+	service.addMessageHandler(msgObjectPath, nil, nil, service.msgCancelChan)
+}
+
+// RedownloadEnded closes the handler of the message identified by uuid, which was redownloaded, and emits the
+// MessageRemoved signal for it. Nothing is done if the message is not redownloaded or it was already ended.
+func (service *MMSService) RedownloadEnded(uuid string) {
+	if service == nil {
+		return
+	}
+	path := service.GenMessagePath(uuid)
+	service.handlersLock.Lock()
+	msgInterface, ok := service.messageHandlers[path]
+	if !ok || msgInterface.cancelChan == nil {
+		service.handlersLock.Unlock()
+		return
+	}
+	delete(service.messageHandlers, path)
+	service.handlersLock.Unlock()
+
+	msgInterface.Close()
+	if err := service.SingnalMessageRemoved(path); err != nil {
+		log.Printf("Error sending signal that message %s was removed: %v", path, err)
+	}
+}
+
+// addMessageHandler creates an object path on the message interface for the message on path,
+// closing the previous handler of the path.
+func (service *MMSService) addMessageHandler(path dbus.ObjectPath, deleteChan, redownloadChan, cancelChan chan dbus.ObjectPath) {
+	service.handlersLock.Lock()
+	defer service.handlersLock.Unlock()
+	if previous, ok := service.messageHandlers[path]; ok {
+		previous.Close()
+	}
+	service.messageHandlers[path] = NewMessageInterface(service.conn, path, deleteChan, redownloadChan, cancelChan)
+}
+
 //MessageAdded emits a MessageAdded with the path to the added message which
 //is taken as a parameter
 func (service *MMSService) MessageAdded(msgPayload *Payload) error {
@@ -491,10 +908,14 @@ func (service *MMSService) isService(identity string) bool {
 }
 
 func (service *MMSService) Close() {
+	if service.historyWatch != nil {
+		service.historyWatch.Cancel()
+	}
 	service.conn.UnregisterObjectPath(service.payload.Path)
 	close(service.msgChan)
 	close(service.msgDeleteChan)
 	close(service.msgRedownloadChan)
+	close(service.msgCancelChan)
 }
 
 func (service *MMSService) parseMessage(mRetConf *mms.MRetrieveConf) (Payload, error) {
@@ -502,12 +923,15 @@ func (service *MMSService) parseMessage(mRetConf *mms.MRetrieveConf) (Payload, e
 	params["Status"] = dbus.Variant{"received"}
 	//TODO retrieve date correctly
 	params["Date"] = dbus.Variant{parseDate(mRetConf.Date)}
-	params["Sender"] = dbus.Variant{strings.TrimSuffix(mRetConf.From, PLMN)}
+	params["Sender"] = dbus.Variant{mms.DecodeAddress(mRetConf.From).Value}
 	if mRetConf.Subject != "" {
 		params["Subject"] = dbus.Variant{mRetConf.Subject}
 	}
 
-	params["Recipients"] = dbus.Variant{parseRecipients(strings.Join(mRetConf.To, ","))}
+	params["Recipients"] = dbus.Variant{mms.AddressValues(mRetConf.To)}
+	if len(mRetConf.Cc) > 0 {
+		params["Cc"] = dbus.Variant{mms.AddressValues(mRetConf.Cc)}
+	}
 	if smil, err := mRetConf.GetSmil(); err == nil {
 		params["Smil"] = dbus.Variant{smil}
 	}
@@ -520,13 +944,32 @@ func (service *MMSService) parseMessage(mRetConf *mms.MRetrieveConf) (Payload, e
 		} else {
 			return Payload{}, err
 		}
+		id := dataParts[i].ContentId
+		if id == "" {
+			id = dataParts[i].PartName()
+		}
 		attachment := Attachment{
-			Id:        dataParts[i].ContentId,
+			Id:        id,
 			MediaType: dataParts[i].MediaType,
 			FilePath:  filePath,
 			Offset:    uint64(dataParts[i].Offset),
 			Length:    uint64(len(dataParts[i].Data)),
 		}
+		if dataParts[i].IsText() && !mms.IsUTF8Compatible(dataParts[i].Charset) {
+			// Clients expect text in UTF-8, so hand out a transcoded copy of the part.
+			text, err := dataParts[i].Text()
+			if err != nil {
+				log.Printf("Text part %d of message %s: %v", i, mRetConf.UUID, err)
+			}
+			if textPath, err := storage.SaveTextPart(mRetConf.UUID, i, text); err == nil {
+				attachment.MediaType = "text/plain;charset=utf-8"
+				attachment.FilePath = textPath
+				attachment.Offset = 0
+				attachment.Length = uint64(len(text))
+			} else {
+				log.Printf("Cannot store transcoded text part %d of message %s: %v", i, mRetConf.UUID, err)
+			}
+		}
 		attachments = append(attachments, attachment)
 	}
 	params["Attachments"] = dbus.Variant{attachments}
@@ -540,21 +983,10 @@ func parseDate(unixTime uint64) string {
 	return date.Format(time.RFC3339)
 }
 
-func parseRecipients(to string) []string {
-	recipients := strings.Split(to, ",")
-	for i := range recipients {
-		if strings.HasSuffix(recipients[i], PLMN) {
-			recipients[i] = recipients[i][:len(recipients[i])-len(PLMN)]
-		}
-	}
-	return recipients
-}
-
 func (service *MMSService) MessageDestroy(uuid string) error {
 	msgObjectPath := service.GenMessagePath(uuid)
-	if msgInterface, ok := service.messageHandlers[msgObjectPath]; ok {
+	if msgInterface, ok := service.removeMessageHandler(msgObjectPath); ok {
 		msgInterface.Close()
-		delete(service.messageHandlers, msgObjectPath)
 		return nil
 	}
 	return fmt.Errorf("no message interface handler for object path %s", msgObjectPath)
@@ -562,24 +994,191 @@ func (service *MMSService) MessageDestroy(uuid string) error {
 
 func (service *MMSService) MessageStatusChanged(uuid, status string) error {
 	msgObjectPath := service.GenMessagePath(uuid)
-	if msgInterface, ok := service.messageHandlers[msgObjectPath]; ok {
+	if msgInterface, ok := service.getMessageHandler(msgObjectPath); ok {
 		return msgInterface.StatusChanged(status)
 	}
 	return fmt.Errorf("no message interface handler for object path %s", msgObjectPath)
 }
 
+// MessageSendFailed changes the Status of the outgoing message identified by uuid to PermanentError
+// and sets its Error property to a json object holding the error code and message of sendError.
+func (service *MMSService) MessageSendFailed(uuid string, sendError error) error {
+	return service.messageSendError(uuid, sendError, PERMANENT_ERROR)
+}
+
+// MessageSendDelayed changes the Status of the outgoing message identified by uuid to TransientError,
+// as sending it is retried later, and sets its Error property like MessageSendFailed.
+func (service *MMSService) MessageSendDelayed(uuid string, sendError error) error {
+	return service.messageSendError(uuid, sendError, TRANSIENT_ERROR)
+}
+
+func (service *MMSService) messageSendError(uuid string, sendError error, status string) error {
+	msgObjectPath := service.GenMessagePath(uuid)
+	msgInterface, ok := service.getMessageHandler(msgObjectPath)
+	if !ok {
+		return fmt.Errorf("no message interface handler for object path %s", msgObjectPath)
+	}
+	errorMessage, err := json.Marshal(&struct {
+		Code    string
+		Message string
+	}{errorCode(sendError), sendError.Error()})
+	if err != nil {
+		return err
+	}
+	if err := msgInterface.ErrorChanged(string(errorMessage)); err != nil {
+		return err
+	}
+	return msgInterface.StatusChanged(status)
+}
+
+// errorCode returns the code of err if it has one.
+func errorCode(err error) string {
+	if eci, ok := err.(interface{ Code() string }); ok {
+		return eci.Code()
+	}
+	return "x-ubports-nuntium-mms-error-unknown"
+}
+
+// MessageDeliveryReported signals a PropertyChanged of the DeliveryReport property
+// for the sent message identified by uuid, with a map holding the recipient and its delivery status.
+// The signal is emitted on the message object path even if the message handler was already destroyed,
+// as delivery reports usually arrive long after the message was sent.
+func (service *MMSService) MessageDeliveryReported(uuid, recipient, status string) error {
+	msgObjectPath := service.GenMessagePath(uuid)
+	signal := dbus.NewSignalMessage(msgObjectPath, MMS_MESSAGE_DBUS_IFACE, propertyChangedSignal)
+	if err := signal.AppendArgs(deliveryReportProperty, dbus.Variant{map[string]string{recipient: status}}); err != nil {
+		return err
+	}
+	if err := service.conn.Send(signal); err != nil {
+		return err
+	}
+	log.Print("Delivery report for ", msgObjectPath, ": ", recipient, " ", status)
+	return nil
+}
+
+// MessageResponseReceived sets the MessageId, ResponseStatus and ResponseText properties of the outgoing
+// message identified by uuid from the m-send.conf the MMS center answered with.
+func (service *MMSService) MessageResponseReceived(uuid string, mSendConf *mms.MSendConf) error {
+	msgObjectPath := service.GenMessagePath(uuid)
+	if msgInterface, ok := service.getMessageHandler(msgObjectPath); ok {
+		return msgInterface.ResponseChanged(mSendConf.MessageId, mSendConf.ResponseStatus, mSendConf.ResponseText)
+	}
+	return fmt.Errorf("no message interface handler for object path %s", msgObjectPath)
+}
+
+// MessageRecipientStatusChanged signals a change of the RecipientStatus property to sendState for the sent
+// message identified by uuid. The signal is emitted on the message object path even if the message handler
+// was already destroyed.
+func (service *MMSService) MessageRecipientStatusChanged(uuid string, sendState storage.SendInfo) error {
+	msgObjectPath := service.GenMessagePath(uuid)
+	if msgInterface, ok := service.getMessageHandler(msgObjectPath); ok {
+		return msgInterface.RecipientStatusChanged(sendState)
+	}
+	return messagePropertyChanged(service.conn, msgObjectPath, recipientStatusProperty, map[string]string(sendState))
+}
+
+// TransferProgress returns a function signalling the progress of transferring the message identified by uuid,
+// as changes of the TransferredBytes and TotalBytes properties. The signals are emitted only while the message
+// is handled, so that clients know its object path, at most once per progressInterval, except the last one.
+func (service *MMSService) TransferProgress(uuid string) mms.ProgressFunc {
+	if service == nil {
+		return nil
+	}
+	msgObjectPath := service.GenMessagePath(uuid)
+	throttled := throttleProgress(progressInterval)
+	return func(transferred, total uint64) {
+		if throttled(transferred, total) {
+			return
+		}
+		msgInterface, ok := service.getMessageHandler(msgObjectPath)
+		if !ok {
+			return
+		}
+		if err := msgInterface.ProgressChanged(transferred, total); err != nil {
+			log.Printf("Error signalling transfer progress of %s: %v", msgObjectPath, err)
+		}
+	}
+}
+
+// throttleProgress returns a function reporting if a progress change comes sooner than interval after the
+// previous one, which wasn't throttled. The last change, when everything was transferred, is never throttled.
+func throttleProgress(interval time.Duration) func(transferred, total uint64) bool {
+	var lastChange time.Time
+	return func(transferred, total uint64) bool {
+		now := time.Now()
+		if now.Sub(lastChange) < interval && transferred != total {
+			return true
+		}
+		lastChange = now
+		return false
+	}
+}
+
+// MessageRead signals a change of the Status property to Read for the sent message identified by uuid.
+// The signal is emitted on the message object path even if the message handler was already destroyed.
+func (service *MMSService) MessageRead(uuid string) error {
+	msgObjectPath := service.GenMessagePath(uuid)
+	if msgInterface, ok := service.getMessageHandler(msgObjectPath); ok {
+		return msgInterface.StatusChanged(READ)
+	}
+	signal := dbus.NewSignalMessage(msgObjectPath, MMS_MESSAGE_DBUS_IFACE, propertyChangedSignal)
+	if err := signal.AppendArgs(statusProperty, dbus.Variant{READ}); err != nil {
+		return err
+	}
+	if err := service.conn.Send(signal); err != nil {
+		return err
+	}
+	log.Print("Status changed for ", msgObjectPath, " to ", READ)
+	return nil
+}
+
 func (service *MMSService) ReplySendMessage(reply *dbus.Message, uuid string) (dbus.ObjectPath, error) {
 	msgObjectPath := service.GenMessagePath(uuid)
 	reply.AppendArgs(msgObjectPath)
 	if err := service.conn.Send(reply); err != nil {
 		return "", err
 	}
-	msg := NewMessageInterface(service.conn, msgObjectPath, service.msgDeleteChan, nil)
+	msg := NewMessageInterface(service.conn, msgObjectPath, service.msgDeleteChan, nil, nil)
+	service.handlersLock.Lock()
 	service.messageHandlers[msgObjectPath] = msg
+	service.handlersLock.Unlock()
 	service.MessageAdded(msg.GetPayload())
 	return msgObjectPath, nil
 }
 
+// OutgoingMessageRestored handles the outgoing message identified by uuid again after a restart, so that
+// its status changes are signaled on the object path returned by SendMessage. No MessageAdded is emitted.
+func (service *MMSService) OutgoingMessageRestored(uuid string) (dbus.ObjectPath, error) {
+	if service == nil {
+		return "", ErrorNilMMSService
+	}
+	msgObjectPath := service.GenMessagePath(uuid)
+	service.handlersLock.Lock()
+	defer service.handlersLock.Unlock()
+	if _, ok := service.messageHandlers[msgObjectPath]; ok {
+		return msgObjectPath, nil
+	}
+	service.messageHandlers[msgObjectPath] = NewMessageInterface(service.conn, msgObjectPath, service.msgDeleteChan, nil, nil)
+	return msgObjectPath, nil
+}
+
+// getMessageHandler returns the handler of the message on path, if it is handled.
+func (service *MMSService) getMessageHandler(path dbus.ObjectPath) (*MessageInterface, bool) {
+	service.handlersLock.RLock()
+	defer service.handlersLock.RUnlock()
+	msgInterface, ok := service.messageHandlers[path]
+	return msgInterface, ok
+}
+
+// removeMessageHandler stops handling the message on path and returns its handler, which the caller closes.
+func (service *MMSService) removeMessageHandler(path dbus.ObjectPath) (*MessageInterface, bool) {
+	service.handlersLock.Lock()
+	defer service.handlersLock.Unlock()
+	msgInterface, ok := service.messageHandlers[path]
+	delete(service.messageHandlers, path)
+	return msgInterface, ok
+}
+
 //TODO randomly creating a uuid until the download manager does this for us
 func (service *MMSService) GenMessagePath(uuid string) dbus.ObjectPath {
 	if service == nil {
@@ -621,6 +1220,44 @@ func (service *MMSService) MobileDataEnabled() (bool, error) {
 	return enabled, nil
 }
 
+// WatchMobileDataEnabled watches changes of the MobileDataEnabled property of the connectivity service.
+// The returned channel receives the new value on each change, until the returned watch is cancelled.
+func (service *MMSService) WatchMobileDataEnabled() (*dbus.SignalWatch, <-chan bool, error) {
+	watch, err := service.conn.WatchSignal(&dbus.MatchRule{
+		Type:      dbus.TypeSignal,
+		Interface: "org.freedesktop.DBus.Properties",
+		Member:    "PropertiesChanged",
+		Path:      "/com/ubuntu/connectivity1/Private",
+		Arg0:      "com.ubuntu.connectivity1.Private",
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("PropertiesChanged watch error: %w", err)
+	}
+
+	enabled := make(chan bool)
+	go func() {
+		defer close(enabled)
+		for signal := range watch.C {
+			var iface string
+			var changed map[string]dbus.Variant
+			var invalidated []string
+			if err := signal.Args(&iface, &changed, &invalidated); err != nil {
+				log.Printf("WatchMobileDataEnabled: signal arguments error: %v", err)
+				continue
+			}
+			if v, ok := changed["MobileDataEnabled"].Value.(bool); ok {
+				enabled <- v
+			}
+		}
+	}()
+	return watch, enabled, nil
+}
+
+// RedownloadMessage redownloads the incoming message identified by uuid, as if Redownload was called on it.
+func (service *MMSService) RedownloadMessage(uuid string) {
+	service.msgRedownloadChan <- service.GenMessagePath(uuid)
+}
+
 func (service *MMSService) HistoryService() *history.HistoryService {
 	if service == nil {
 		return nil
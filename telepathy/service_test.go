@@ -0,0 +1,160 @@
+package telepathy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ubports/nuntium/mms"
+	"launchpad.net/go-dbus/v1"
+)
+
+func newTestService(t *testing.T) (*MMSService, <-chan string) {
+	conn, err := dbus.Connect(dbus.SessionBus)
+	if err != nil {
+		t.Skipf("No session bus: %v", err)
+	}
+	cancelled := make(chan string, 1)
+	service := &MMSService{
+		conn:               conn,
+		identity:           "test",
+		messageHandlers:    make(map[dbus.ObjectPath]*MessageInterface),
+		msgDeleteChan:      make(chan dbus.ObjectPath),
+		msgRedownloadChan:  make(chan dbus.ObjectPath),
+		msgCancelChan:      make(chan dbus.ObjectPath),
+		downloadCancelChan: cancelled,
+	}
+	go service.watchMessageCancelCalls()
+	return service, cancelled
+}
+
+// callMessage delivers a method call on the message interface to the handler of the message on path,
+// as the bus does, and waits until the handler is done with it.
+func callMessage(t *testing.T, service *MMSService, path dbus.ObjectPath, method string) {
+	msgInterface, ok := service.getMessageHandler(path)
+	if !ok {
+		t.Fatalf("Message %s is not handled", path)
+	}
+	msgInterface.msgChan <- dbus.NewMethodCallMessage(MMS_DBUS_NAME, path, MMS_MESSAGE_DBUS_IFACE, method)
+	// The handler takes the next call after handling the previous one.
+	msgInterface.msgChan <- dbus.NewMethodCallMessage(MMS_DBUS_NAME, path, MMS_MESSAGE_DBUS_IFACE, "Unknown")
+}
+
+func TestRedownloadCancel(t *testing.T) {
+	service, cancelled := newTestService(t)
+	defer close(service.msgCancelChan)
+
+	// The client knows the failed message from MessageAdded and calls Redownload on it.
+	path := service.GenMessagePath("failed")
+	service.addMessageHandler(path, service.msgDeleteChan, service.msgRedownloadChan, nil)
+	callMessage(t, service, path, "Cancel")
+	select {
+	case uuid := <-cancelled:
+		t.Fatalf("Cancel of %s before redownload was forwarded", uuid)
+	default:
+	}
+
+	service.redownloadStarted(path)
+	callMessage(t, service, path, "Cancel")
+	select {
+	case uuid := <-cancelled:
+		if uuid != "failed" {
+			t.Errorf("Cancel forwarded %s, want failed", uuid)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Cancel of the redownloaded message wasn't forwarded")
+	}
+
+	service.RedownloadEnded("failed")
+	if _, ok := service.getMessageHandler(path); ok {
+		t.Errorf("Message %s is still handled after the redownload ended", path)
+	}
+	// Ending again does nothing.
+	service.RedownloadEnded("failed")
+}
+
+func TestTransferProgress(t *testing.T) {
+	service, _ := newTestService(t)
+	defer close(service.msgCancelChan)
+
+	// Messages the client doesn't know are not signalled.
+	service.TransferProgress("unknown")(10, 100)
+
+	path := service.GenMessagePath("sent")
+	service.addMessageHandler(path, service.msgDeleteChan, nil, nil)
+	service.TransferProgress("sent")(100, 100)
+}
+
+func TestThrottleProgress(t *testing.T) {
+	throttled := throttleProgress(time.Hour)
+	for _, p := range []struct {
+		transferred, total uint64
+		want               bool
+	}{
+		{10, 100, false},
+		// Too soon after the previous change.
+		{50, 100, true},
+		// The last change is never throttled.
+		{100, 100, false},
+		{100, 100, false},
+	} {
+		if got := throttled(p.transferred, p.total); got != p.want {
+			t.Errorf("Progress %d/%d throttled = %v, want %v", p.transferred, p.total, got, p.want)
+		}
+	}
+}
+
+func TestTimeOption(t *testing.T) {
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+	testCases := []struct {
+		value   interface{}
+		want    mms.TimeValue
+		wantErr bool
+	}{
+		{int32(60), mms.RelativeTime(time.Minute), false},
+		{uint32(60), mms.RelativeTime(time.Minute), false},
+		{int64(60), mms.RelativeTime(time.Minute), false},
+		{uint64(60), mms.RelativeTime(time.Minute), false},
+		{int64(maxRelativeSeconds), mms.TimeValue{Seconds: uint64(maxRelativeSeconds)}, false},
+		{future.Format(time.RFC3339), mms.AbsoluteTime(future), false},
+		{int32(0), mms.TimeValue{}, true},
+		{int64(-60), mms.TimeValue{}, true},
+		{int64(maxRelativeSeconds + 1), mms.TimeValue{}, true},
+		{uint64(1 << 63), mms.TimeValue{}, true},
+		{"1970-01-01T00:00:00Z", mms.TimeValue{}, true},
+		{"1960-01-01T00:00:00Z", mms.TimeValue{}, true},
+		{time.Now().Add(-time.Hour).Format(time.RFC3339), mms.TimeValue{}, true},
+		{"tomorrow", mms.TimeValue{}, true},
+		{true, mms.TimeValue{}, true},
+	}
+
+	for _, tc := range testCases {
+		got, err := timeOption("Expiry", dbus.Variant{Value: tc.value})
+		if (err != nil) != tc.wantErr {
+			t.Errorf("timeOption(%v) error = %v, want error %v", tc.value, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("timeOption(%v) = %+v, want %+v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestPropertiesConcurrentAccess(t *testing.T) {
+	service := &MMSService{Properties: map[string]dbus.Variant{deferredDownloadProperty: dbus.Variant{false}}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			service.setPropertyValue(deferredDownloadProperty, i%2 == 0)
+			service.setPropertyValue(preferredContextProperty, dbus.ObjectPath("/"))
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		service.DeferredDownload()
+		service.properties()
+	}
+	<-done
+	if service.DeferredDownload() {
+		t.Errorf("DeferredDownload = true after setting it to false last")
+	}
+}